@@ -0,0 +1,155 @@
+package secret
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// API tokens are formatted in the style of GitHub: a product prefix (e.g. "acme_live_")
+// followed by random base62 characters and a CRC32 checksum of everything before it,
+// e.g. "acme_live_sNMO1k5HFwm4GQ0IFzGcA1GdM2Ge5P43iMyj". The prefix allows secret
+// scanners to recognize leaked tokens, while the checksum catches typos without
+// looking up the token.
+
+var (
+	ErrInvalidAPIToken  = errors.New("invalid api token")
+	ErrAPITokenChecksum = fmt.Errorf("%w: checksum mismatch", ErrInvalidAPIToken)
+)
+
+const (
+	// APITokenEntropyLength is the number of random base62 characters of tokens, which
+	// carries about 178 bits of entropy.
+	APITokenEntropyLength = 30
+	// APITokenChecksumLength is the number of base62 characters of CRC32 checksum of tokens.
+	APITokenChecksumLength = 6
+
+	// APITokenHashLength is the length of hashes returned by APITokenHasher.
+	APITokenHashLength = sha256.Size
+
+	base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// NewAPIToken returns a random token with prefix, which may only consist of ASCII letters,
+// digits, and underscores.
+func NewAPIToken(prefix string) (string, error) {
+	if err := validateAPITokenPrefix(prefix); err != nil {
+		return "", err
+	}
+	token := make([]byte, len(prefix), len(prefix)+APITokenEntropyLength+APITokenChecksumLength)
+	copy(token, prefix)
+
+	// Random bytes are rejected above the largest multiple of 62, so that every
+	// character is equally likely.
+	var buf [APITokenEntropyLength * 2]byte
+	for len(token) < len(prefix)+APITokenEntropyLength {
+		if _, err := rand.Read(buf[:]); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if b < 248 && len(token) < len(prefix)+APITokenEntropyLength {
+				token = append(token, base62Alphabet[b%62])
+			}
+		}
+	}
+	return string(appendAPITokenChecksum(token, crc32.ChecksumIEEE(token))), nil
+}
+
+// ParseAPIToken validates format and checksum of token, returning its prefix. Tokens which
+// fail validation are refused with error wrapping ErrInvalidAPIToken, therefore need not be
+// looked up.
+func ParseAPIToken(token string) (prefix string, err error) {
+	if len(token) <= APITokenEntropyLength+APITokenChecksumLength {
+		return "", fmt.Errorf("%w: too short", ErrInvalidAPIToken)
+	}
+	body := token[:len(token)-APITokenChecksumLength]
+	prefix = body[:len(body)-APITokenEntropyLength]
+	if err := validateAPITokenPrefix(prefix); err != nil {
+		return "", err
+	}
+	for i := len(prefix); i < len(token); i++ {
+		if !isBase62(token[i]) {
+			return "", fmt.Errorf("%w: unexpected character %q", ErrInvalidAPIToken, token[i])
+		}
+	}
+	checksum := appendAPITokenChecksum(nil, crc32.ChecksumIEEE([]byte(body)))
+	if string(checksum) != token[len(body):] {
+		return "", ErrAPITokenChecksum
+	}
+	return prefix, nil
+}
+
+// ValidateAPIToken is similar to ParseAPIToken, except it also refuses tokens with
+// another prefix, e.g. test tokens in production.
+func ValidateAPIToken(prefix, token string) error {
+	actual, err := ParseAPIToken(token)
+	if err != nil {
+		return err
+	}
+	if actual != prefix {
+		return fmt.Errorf("%w: unexpected prefix %q", ErrInvalidAPIToken, actual)
+	}
+	return nil
+}
+
+// APITokenHasher computes keyed hashes of tokens, which are stored (and looked up) instead
+// of the tokens themselves, so that leaked storage does not reveal usable tokens.
+// Unlike HMAC of Authenticator, hashes are deterministic, therefore can be indexed.
+type APITokenHasher struct {
+	key []byte
+}
+
+// NewAPITokenHasher returns APITokenHasher keyed by key, which must be at least 32 bytes
+// and separate from encryption keys.
+func NewAPITokenHasher(key []byte) (*APITokenHasher, error) {
+	if len(key) < AES256KeyLength {
+		return nil, fmt.Errorf("api token hash key must be at least %d bytes, received %d", AES256KeyLength, len(key))
+	}
+	return &APITokenHasher{key: hkdf(sha256.New, key, nil, []byte("secret-api-token-hash"), sha256.Size)}, nil
+}
+
+// Hash returns keyed hash of token, which is APITokenHashLength bytes. Tokens should be
+// validated with ParseAPIToken beforehand, to avoid looking up hashes of mistyped tokens.
+func (h *APITokenHasher) Hash(token string) []byte {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(token))
+	return mac.Sum(nil)
+}
+
+// Verify validates token against its stored hash in constant time, returning
+// ErrInvalidAPIToken if they do not match.
+func (h *APITokenHasher) Verify(token string, hash []byte) error {
+	if !hmac.Equal(h.Hash(token), hash) {
+		return ErrInvalidAPIToken
+	}
+	return nil
+}
+
+func validateAPITokenPrefix(prefix string) error {
+	if prefix == "" {
+		return fmt.Errorf("%w: missing prefix", ErrInvalidAPIToken)
+	}
+	for i := 0; i < len(prefix); i++ {
+		if c := prefix[i]; c != '_' && !isBase62(c) {
+			return fmt.Errorf("%w: unexpected character %q in prefix", ErrInvalidAPIToken, c)
+		}
+	}
+	return nil
+}
+
+// appendAPITokenChecksum appends checksum to dst as base62, zero-padded to APITokenChecksumLength.
+func appendAPITokenChecksum(dst []byte, checksum uint32) []byte {
+	var buf [APITokenChecksumLength]byte
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = base62Alphabet[checksum%62]
+		checksum /= 62
+	}
+	return append(dst, buf[:]...)
+}
+
+func isBase62(c byte) bool {
+	return '0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z'
+}
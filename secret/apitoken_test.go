@@ -0,0 +1,117 @@
+package secret
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAPIToken(t *testing.T) {
+	token, err := NewAPIToken("acme_live_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("token: %s", token)
+	if len(token) != len("acme_live_")+APITokenEntropyLength+APITokenChecksumLength {
+		t.Fatalf("unexpected token length: %d", len(token))
+	}
+	prefix, err := ParseAPIToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefix != "acme_live_" {
+		t.Fatalf("unexpected prefix: %s", prefix)
+	}
+	if err := ValidateAPIToken("acme_live_", token); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateAPIToken("acme_test_", token); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Fatalf("expecting ErrInvalidAPIToken, but received %v", err)
+	}
+
+	other, err := NewAPIToken("acme_live_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == token {
+		t.Fatal("tokens are unexpectedly equal")
+	}
+
+	if _, err := NewAPIToken(""); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Fatalf("expecting ErrInvalidAPIToken, but received %v", err)
+	}
+	if _, err := NewAPIToken("acme-live-"); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Fatalf("expecting ErrInvalidAPIToken, but received %v", err)
+	}
+}
+
+func TestAPITokenChecksum(t *testing.T) {
+	token := "acme_live_sNMO1k5HFwm4GQ0IFzGcA1GdM2Ge5P43iMyj"
+	if _, err := ParseAPIToken(token); err != nil {
+		t.Fatal(err)
+	}
+	// Typos in any of prefix, entropy, or checksum are caught.
+	for _, i := range []int{0, 12, 39, len(token) - 1} {
+		typo := []byte(token)
+		if typo[i] == 'x' {
+			typo[i] = 'y'
+		} else {
+			typo[i] = 'x'
+		}
+		if _, err := ParseAPIToken(string(typo)); !errors.Is(err, ErrAPITokenChecksum) {
+			t.Fatalf("%s: expecting ErrAPITokenChecksum, but received %v", typo, err)
+		}
+	}
+	for _, invalid := range []string{
+		"",
+		token[len("acme_live_"):],
+		token[:len(token)-1],
+		strings.Replace(token, "sNMO", "sN-O", 1),
+		strings.Replace(token, "acme_", "acme.", 1),
+	} {
+		if _, err := ParseAPIToken(invalid); !errors.Is(err, ErrInvalidAPIToken) {
+			t.Fatalf("%q: expecting ErrInvalidAPIToken, but received %v", invalid, err)
+		}
+	}
+}
+
+func TestAPITokenHasher(t *testing.T) {
+	key, err := KeyFromString("955880d5f4f43c66751848c06fedb78e420995b373418dcfb856ca559deb71c3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasher, err := NewAPITokenHasher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := "acme_live_sNMO1k5HFwm4GQ0IFzGcA1GdM2Ge5P43iMyj"
+	hash := hasher.Hash(token)
+	if len(hash) != APITokenHashLength {
+		t.Fatalf("unexpected hash length: %d", len(hash))
+	}
+	if !bytes.Equal(hash, hasher.Hash(token)) {
+		t.Fatal("hashes of the same token are unexpectedly unequal")
+	}
+	if err := hasher.Verify(token, hash); err != nil {
+		t.Fatal(err)
+	}
+	if err := hasher.Verify(strings.ToLower(token), hash); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Fatalf("expecting ErrInvalidAPIToken, but received %v", err)
+	}
+
+	// Hashes depend on the key.
+	otherKey := append([]byte(nil), key...)
+	otherKey[0] ^= 1
+	other, err := NewAPITokenHasher(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(hash, other.Hash(token)) {
+		t.Fatal("hashes with different keys are unexpectedly equal")
+	}
+
+	if _, err := NewAPITokenHasher(key[:16]); err == nil {
+		t.Fatal("short key was unexpectedly accepted")
+	}
+}
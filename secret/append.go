@@ -0,0 +1,205 @@
+package secret
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+)
+
+// AppendAuthenticator is implemented by authenticators which are able to append their
+// output to caller-provided buffers, similar to cipher.AEAD, so that hot paths can
+// reuse buffers rather than allocating on every call. The output never retains its
+// input, therefore buffers can be reused once the call returns.
+type AppendAuthenticator interface {
+	Authenticator
+	// EncryptAppend is similar to Encrypt, except the ciphertext is appended to dst.
+	EncryptAppend(dst, secret []byte) ([]byte, error)
+	// DecryptAppend is similar to Decrypt, except the secret is appended to dst.
+	DecryptAppend(dst, ciphertext []byte) ([]byte, error)
+	// HMACAppend is similar to HMAC, except the MAC is appended to dst.
+	HMACAppend(dst, msg []byte) ([]byte, error)
+}
+
+var _ AppendAuthenticator = (*AESGCM)(nil)
+
+// maxPooledBufferSize limits buffers which are returned to bufferPool, so that
+// occasional large values do not pin memory.
+const maxPooledBufferSize = 64 << 10
+
+// bufferPool holds scratch buffers for intermediate ciphertexts and MACs, which are
+// not returned to callers.
+var bufferPool = sync.Pool{
+	New: func() any { return new([]byte) },
+}
+
+func getBuffer() *[]byte {
+	buf := bufferPool.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+func putBuffer(buf *[]byte) {
+	if cap(*buf) <= maxPooledBufferSize {
+		bufferPool.Put(buf)
+	}
+}
+
+// sliceForAppend extends in by n bytes, returning the extended slice and its tail,
+// which has room for n bytes. If in does not have sufficient capacity, a new slice
+// is allocated and in is copied over.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+// EncryptAppend is similar to Encrypt, except the ciphertext is appended to dst.
+func (a *AESGCM) EncryptAppend(dst, secret []byte) ([]byte, error) {
+	return a.encryptAppend(dst, secret, nil)
+}
+
+func (a *AESGCM) encryptAppend(dst, secret, additionalData []byte) ([]byte, error) {
+	// NIST: For GCM a 12 byte IV is strongly suggested as other IV lengths will
+	// require additional calculations.
+	// crypto/cipher: Never use more than 2^32 random nonces with a given key
+	// because of the risk of a repeat.
+	ret, out := sliceForAppend(dst, aesGCMNonceLength+len(secret)+a.authenticator.Overhead())
+	nonce := out[:aesGCMNonceLength]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	// Ciphertext is sealed in place right after the nonce, as out has sufficient capacity.
+	a.authenticator.Seal(nonce, nonce, secret, additionalData)
+	return ret, nil
+}
+
+// DecryptAppend is similar to Decrypt, except the secret is appended to dst.
+func (a *AESGCM) DecryptAppend(dst, data []byte) ([]byte, error) {
+	secret, _, err := a.decryptWithExpiryAppend(dst, data)
+	return secret, err
+}
+
+func (a *AESGCM) decryptAppend(dst, data, additionalData []byte) ([]byte, error) {
+	if len(data) < aesGCMNonceLength {
+		return nil, fmt.Errorf("ciphertext is too short: expected at least %d bytes, actual %d", aesGCMNonceLength, len(data))
+	}
+	nonce := data[:aesGCMNonceLength]
+	ciphertext := data[aesGCMNonceLength:]
+
+	return a.authenticator.Open(dst, nonce, ciphertext, additionalData)
+}
+
+// EncryptBase64Append is similar to EncryptBase64, except the output is appended to dst.
+func (a *AESGCM) EncryptBase64Append(dst, secret []byte) ([]byte, error) {
+	return encryptTextAppend(a, dst, secret, EncodingBase64URL)
+}
+
+// DecryptBase64Append is similar to DecryptBase64, except the secret is appended to dst.
+func (a *AESGCM) DecryptBase64Append(dst, b64 []byte) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	ciphertext, err := EncodingBase64URL.AppendDecode(*buf, b64)
+	if err != nil {
+		return nil, err
+	}
+	*buf = ciphertext
+	return a.DecryptAppend(dst, ciphertext)
+}
+
+// HMACAppend is similar to HMAC, except the MAC is appended to dst.
+func (a *AESGCM) HMACAppend(dst, msg []byte) ([]byte, error) {
+	h := a.getHMAC()
+	defer a.hmacPool.Put(h)
+	ret, out := sliceForAppend(dst, a.hmacNonceLength+h.Size())
+	nonce := out[:a.hmacNonceLength]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	h.Write(nonce)
+	h.Write(msg)
+	// MAC is summed in place right after the nonce, as ret has sufficient capacity.
+	return h.Sum(ret[:len(dst)+a.hmacNonceLength]), nil
+}
+
+// getHMAC returns a reset HMAC from the pool of a, which should be put back once done.
+func (a *AESGCM) getHMAC() hash.Hash {
+	h := a.hmacPool.Get().(hash.Hash)
+	h.Reset()
+	return h
+}
+
+func newHMACPool(a *AESGCM) *sync.Pool {
+	return &sync.Pool{
+		New: func() any { return hmac.New(a.hmacHash, a.hmacKey) },
+	}
+}
+
+// AppendEncode appends data encoded as text to dst.
+func (e Encoding) AppendEncode(dst, data []byte) []byte {
+	switch e {
+	case EncodingBase64:
+		ret, out := sliceForAppend(dst, base64.StdEncoding.EncodedLen(len(data)))
+		base64.StdEncoding.Encode(out, data)
+		return ret
+	case EncodingHex:
+		ret, out := sliceForAppend(dst, hex.EncodedLen(len(data)))
+		hex.Encode(out, data)
+		return ret
+	case EncodingBase32Crockford:
+		ret, out := sliceForAppend(dst, crockfordEncoding.EncodedLen(len(data)))
+		crockfordEncoding.Encode(out, data)
+		return ret
+	}
+	ret, out := sliceForAppend(dst, base64.RawURLEncoding.EncodedLen(len(data)))
+	base64.RawURLEncoding.Encode(out, data)
+	return ret
+}
+
+// AppendDecode appends data decoded from text to dst.
+func (e Encoding) AppendDecode(dst, text []byte) ([]byte, error) {
+	var ret, out []byte
+	var n int
+	var err error
+	switch e {
+	case EncodingBase64:
+		ret, out = sliceForAppend(dst, base64.StdEncoding.DecodedLen(len(text)))
+		n, err = base64.StdEncoding.Decode(out, text)
+	case EncodingHex:
+		ret, out = sliceForAppend(dst, hex.DecodedLen(len(text)))
+		n, err = hex.Decode(out, text)
+	case EncodingBase32Crockford:
+		normalized := crockfordNormalizer.Replace(strings.ToUpper(string(text)))
+		ret, out = sliceForAppend(dst, crockfordEncoding.DecodedLen(len(normalized)))
+		n, err = crockfordEncoding.Decode(out, []byte(normalized))
+	default:
+		ret, out = sliceForAppend(dst, base64.RawURLEncoding.DecodedLen(len(text)))
+		n, err = base64.RawURLEncoding.Decode(out, text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ret[:len(dst)+n], nil
+}
+
+// encryptTextAppend encrypts secret with auth into a pooled buffer, and appends it to
+// dst encoded with encoding, so that dst is the only allocation.
+func encryptTextAppend(auth AppendAuthenticator, dst, secret []byte, encoding Encoding) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	ciphertext, err := auth.EncryptAppend(*buf, secret)
+	if err != nil {
+		return nil, err
+	}
+	*buf = ciphertext
+	return encoding.AppendEncode(dst, ciphertext), nil
+}
@@ -0,0 +1,194 @@
+package secret
+
+import (
+	"bytes"
+	"testing"
+)
+
+const benchmarkSecret = "a full commitment's what i'm thinking of"
+
+func TestAppendRoundTrip(t *testing.T) {
+	auth := getAuth()
+	prefix := []byte("poyo:")
+
+	ciphertext, err := auth.EncryptAppend(append([]byte(nil), prefix...), []byte(benchmarkSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(ciphertext, prefix) {
+		t.Fatalf("prefix was not kept: %q", ciphertext)
+	}
+	secret, err := auth.DecryptAppend(append([]byte(nil), prefix...), ciphertext[len(prefix):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != "poyo:"+benchmarkSecret {
+		t.Fatalf("unexpected secret: %q", secret)
+	}
+
+	// Append variants are interchangeable with their allocating counterparts.
+	b64, err := auth.EncryptBase64Append(append([]byte(nil), prefix...), []byte(benchmarkSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err = auth.DecryptBase64(bytes.TrimPrefix(b64, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != benchmarkSecret {
+		t.Fatalf("unexpected secret: %q", secret)
+	}
+	secret, err = auth.DecryptBase64Append(nil, bytes.TrimPrefix(b64, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != benchmarkSecret {
+		t.Fatalf("unexpected secret: %q", secret)
+	}
+
+	mac, err := auth.HMACAppend(append([]byte(nil), prefix...), []byte(benchmarkSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.HMACCheck([]byte(benchmarkSecret), bytes.TrimPrefix(mac, prefix)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppendEncoding(t *testing.T) {
+	data := []byte("poyo\x00\xff kirby")
+	for _, e := range encodings {
+		text := e.AppendEncode([]byte("text:"), data)
+		if !bytes.Equal(text[5:], e.Encode(data)) {
+			t.Fatalf("%s: unexpected text: %q", e, text)
+		}
+		decoded, err := e.AppendDecode([]byte("data:"), text[5:])
+		if err != nil {
+			t.Fatalf("%s: %v", e, err)
+		}
+		if !bytes.Equal(decoded, append([]byte("data:"), data...)) {
+			t.Fatalf("%s: unexpected data: %q", e, decoded)
+		}
+	}
+}
+
+func TestAppendAllocations(t *testing.T) {
+	auth := getAuth()
+	secret := []byte(benchmarkSecret)
+	buf := make([]byte, 0, 1024)
+	ciphertext, err := auth.EncryptAppend(nil, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HMACAppend is not covered, as it relies on sync.Pool which drops items at random
+	// under race detector. See BenchmarkHMACAppend instead.
+	for name, fn := range map[string]func(){
+		"EncryptAppend": func() { auth.EncryptAppend(buf, secret) },
+		"DecryptAppend": func() { auth.DecryptAppend(buf, ciphertext) },
+	} {
+		if allocs := testing.AllocsPerRun(100, fn); allocs > 0 {
+			t.Errorf("%s: expecting no allocations, but received %v per run", name, allocs)
+		}
+	}
+}
+
+func BenchmarkEncryptBase64(b *testing.B) {
+	auth := getAuth()
+	secret := []byte(benchmarkSecret)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := auth.EncryptBase64(secret); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncryptBase64Append(b *testing.B) {
+	auth := getAuth()
+	secret := []byte(benchmarkSecret)
+	buf := make([]byte, 0, 1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := auth.EncryptBase64Append(buf, secret); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecryptBase64(b *testing.B) {
+	auth := getAuth()
+	b64, err := auth.EncryptBase64([]byte(benchmarkSecret))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := auth.DecryptBase64(b64); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecryptBase64Append(b *testing.B) {
+	auth := getAuth()
+	b64, err := auth.EncryptBase64([]byte(benchmarkSecret))
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf := make([]byte, 0, 1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := auth.DecryptBase64Append(buf, b64); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHMAC(b *testing.B) {
+	auth := getAuth()
+	msg := []byte(benchmarkSecret)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := auth.HMAC(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHMACAppend(b *testing.B) {
+	auth := getAuth()
+	msg := []byte(benchmarkSecret)
+	buf := make([]byte, 0, 1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := auth.HMACAppend(buf, msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHMACCheck(b *testing.B) {
+	auth := getAuth()
+	msg := []byte(benchmarkSecret)
+	mac, err := auth.HMAC(msg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := auth.HMACCheck(msg, mac); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalText(b *testing.B) {
+	s := NewStringWithAuth(getAuth(), benchmarkSecret)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.MarshalText(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -4,31 +4,101 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"hash"
+	"sync"
 )
 
 var (
 	ErrHMACMismatch = errors.New("hmac mismatch")
 )
 
-var globalAuth *Authenticator
+var globalAuth Authenticator
 
 const (
 	// Following Content Security Policy spec for nonce size: 128 bits
 	hmacNonceLength = 16
 )
 
-type Authenticator struct {
-	authenticator cipher.AEAD
-	hmac          hash.Hash
+// Authenticator encrypts, decrypts, and authenticates secrets.
+// AESGCM is the default implementation, though alternative backends (e.g. HSM,
+// remote transit services, or fakes for testing) can be used by implementing
+// this interface.
+type Authenticator interface {
+	// Encrypt takes in secret and outputs ciphertext.
+	Encrypt(secret []byte) ([]byte, error)
+	// Decrypt takes in ciphertext and outputs secret.
+	Decrypt(ciphertext []byte) ([]byte, error)
+	// HMAC creates a message authentication code (MAC) for a given message.
+	HMAC(msg []byte) ([]byte, error)
+	// HMACCheck validates if a message and its MAC is consistent,
+	// returning ErrHMACMismatch otherwise.
+	HMACCheck(msg, expected []byte) error
 }
 
-func NewAuthenticatorAESGCM(key []byte) (*Authenticator, error) {
+// Base64Authenticator is implemented by authenticators which have their own
+// text representation of ciphertexts (e.g. Fernet tokens). Otherwise, ciphertexts
+// are encoded with base64.RawURLEncoding.
+type Base64Authenticator interface {
+	Authenticator
+	EncryptBase64(secret []byte) ([]byte, error)
+	DecryptBase64(b64 []byte) ([]byte, error)
+}
+
+var _ Base64Authenticator = (*AESGCM)(nil)
+
+// AdditionalDataAuthenticator is implemented by authenticators which are able to bind
+// ciphertexts to additional data (e.g. where the value is stored), which is authenticated
+// but not encrypted. Decryption fails unless the same additional data is provided.
+type AdditionalDataAuthenticator interface {
+	Authenticator
+	EncryptWithAdditionalData(secret, additionalData []byte) ([]byte, error)
+	DecryptWithAdditionalData(ciphertext, additionalData []byte) ([]byte, error)
+}
+
+var _ AdditionalDataAuthenticator = (*AESGCM)(nil)
+
+// AESGCM is an Authenticator which encrypts with AES-GCM and authenticates with
+// HMAC (SHA-256, unless configured by WithHMACHash).
+type AESGCM struct {
+	authenticator   cipher.AEAD
+	hmacKey         []byte
+	hmacHash        func() hash.Hash
+	hmacNonceLength int
+	hmacPool        *sync.Pool
+	encoding        Encoding
+}
+
+// Option configures optional behavior of an authenticator.
+type Option func(*AESGCM) error
+
+// WithHMACHash configures hash function used by HMAC, e.g. sha512.New384 or sha512.New.
+func WithHMACHash(h func() hash.Hash) Option {
+	return func(a *AESGCM) error {
+		if h == nil {
+			return fmt.Errorf("hmac hash function must not be nil")
+		}
+		a.hmacHash = h
+		return nil
+	}
+}
+
+// WithHMACNonceLength configures length of random nonce prefixed to MAC by HMAC.
+// Both HMAC and HMACCheck must be configured with the same nonce length.
+func WithHMACNonceLength(n int) Option {
+	return func(a *AESGCM) error {
+		if n < 0 {
+			return fmt.Errorf("hmac nonce length must not be negative: %d", n)
+		}
+		a.hmacNonceLength = n
+		return nil
+	}
+}
+
+func NewAuthenticatorAESGCM(key []byte, opts ...Option) (*AESGCM, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -37,11 +107,22 @@ func NewAuthenticatorAESGCM(key []byte) (*Authenticator, error) {
 	if err != nil {
 		return nil, err
 	}
-	h := hmac.New(sha256.New, key)
-	return &Authenticator{authenticator: aead, hmac: h}, nil
+	a := &AESGCM{
+		authenticator:   aead,
+		hmacKey:         key,
+		hmacHash:        sha256.New,
+		hmacNonceLength: hmacNonceLength,
+	}
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
+	}
+	a.hmacPool = newHMACPool(a)
+	return a, nil
 }
 
-func SetGlobal(a *Authenticator) {
+func SetGlobal(a Authenticator) {
 	globalAuth = a
 }
 
@@ -59,7 +140,7 @@ func EncryptBase64(secret []byte) ([]byte, error) {
 	if globalAuth == nil {
 		return nil, fmt.Errorf("unable to encrypt: global authenticator is not set (use SetGlobal)")
 	}
-	return globalAuth.EncryptBase64(secret)
+	return encryptBase64(globalAuth, secret)
 }
 
 // Decrypt takes ciphertext and returns decrypted secret using global authenticator.
@@ -93,93 +174,123 @@ func DecryptBase64(b64 []byte) ([]byte, error) {
 	if globalAuth == nil {
 		return nil, fmt.Errorf("unable to decrypt: global authenticator is not set (use SetGlobal)")
 	}
-	return globalAuth.DecryptBase64(b64)
+	return decryptBase64(globalAuth, b64)
 }
 
 // Encrypt takes in secret and outputs ciphertext
-func (a *Authenticator) Encrypt(secret []byte) ([]byte, error) {
-	// NIST: For GCM a 12 byte IV is strongly suggested as other IV lengths will
-	// require additional calculations.
-	// crypto/cipher: Never use more than 2^32 random nonces with a given key
-	// because of the risk of a repeat.
-	nonce := make([]byte, 12)
-	if _, err := rand.Read(nonce); err != nil {
-		return nil, err
-	}
-	return a.authenticator.Seal(nonce, nonce, secret, nil), nil
+func (a *AESGCM) Encrypt(secret []byte) ([]byte, error) {
+	return a.encrypt(secret, nil)
+}
+
+func (a *AESGCM) encrypt(secret, additionalData []byte) ([]byte, error) {
+	return a.encryptAppend(nil, secret, additionalData)
+}
+
+// EncryptWithAdditionalData is similar to Encrypt, except the ciphertext is bound to
+// additionalData, which must be provided to DecryptWithAdditionalData.
+func (a *AESGCM) EncryptWithAdditionalData(secret, additionalData []byte) ([]byte, error) {
+	return a.encrypt(secret, additionalData)
 }
 
 // EncryptBase64 is similar to Encrypt, except the output value is now Base64-encoded,
 // therefore should be decrypted by DecryptBase64.
-func (a *Authenticator) EncryptBase64(secret []byte) ([]byte, error) {
-	ciphertext, err := a.Encrypt(secret)
-	if err != nil {
-		return nil, err
-	}
-	b64 := make([]byte, base64.RawURLEncoding.EncodedLen(len(ciphertext)))
-	base64.RawURLEncoding.Encode(b64, ciphertext)
-	return b64, nil
+func (a *AESGCM) EncryptBase64(secret []byte) ([]byte, error) {
+	return a.EncryptBase64Append(nil, secret)
+}
+
+// Decrypt takes in ciphertext and outputs secret. Ciphertexts which have expired
+// (see EncryptWithExpiry) are refused with ErrExpired.
+func (a *AESGCM) Decrypt(data []byte) ([]byte, error) {
+	secret, _, err := a.DecryptWithExpiry(data)
+	return secret, err
 }
 
-// Decrypt takes in ciphertext and outputs secret
-func (a *Authenticator) Decrypt(data []byte) ([]byte, error) {
-	nonceSize := a.authenticator.NonceSize()
-	nonce := data[:nonceSize]
-	ciphertext := data[nonceSize:]
+func (a *AESGCM) decrypt(data, additionalData []byte) ([]byte, error) {
+	return a.decryptAppend(nil, data, additionalData)
+}
 
-	return a.authenticator.Open(nil, nonce, ciphertext, nil)
+// DecryptWithAdditionalData decrypts ciphertext encrypted by EncryptWithAdditionalData
+// with the same additionalData.
+func (a *AESGCM) DecryptWithAdditionalData(data, additionalData []byte) ([]byte, error) {
+	return a.decrypt(data, additionalData)
 }
 
 // DecryptBase64 is similar to Decrypt, except it takes input value which was Base64-encoded,
 // therefore should only be used for ciphertexts encrypted by EncryptBase64
-func (a *Authenticator) DecryptBase64(b64 []byte) ([]byte, error) {
-	ciphertext := make([]byte, base64.RawURLEncoding.DecodedLen(len(b64)))
-	if _, err := base64.RawURLEncoding.Decode(ciphertext, b64); err != nil {
-		return nil, err
-	}
-	return a.Decrypt(ciphertext)
+func (a *AESGCM) DecryptBase64(b64 []byte) ([]byte, error) {
+	return a.DecryptBase64Append(nil, b64)
 }
 
 // HMAC creates a message authentication code (MAC) for a given message with nonce prefix.
-func (a *Authenticator) HMAC(msg []byte) ([]byte, error) {
-	nonce := make([]byte, hmacNonceLength)
-	if _, err := rand.Read(nonce); err != nil {
-		return nil, err
-	}
-
-	return a.calcHMAC(nonce, msg)
+func (a *AESGCM) HMAC(msg []byte) ([]byte, error) {
+	return a.HMACAppend(nil, msg)
 }
 
 // HMACCheck validates if a message and its MAC is consistent.
-func (a *Authenticator) HMACCheck(msg, expected []byte) error {
-	// Nonce should be copied over, otherwise it may overwrite expected
-	// when append is called in calcHMAC
-	nonce := make([]byte, hmacNonceLength)
-	n := copy(nonce, expected[:hmacNonceLength])
-	if n != hmacNonceLength {
-		return fmt.Errorf("misaligned nonce copy: expected %d, actual %d", hmacNonceLength, n)
+func (a *AESGCM) HMACCheck(msg, expected []byte) error {
+	if len(expected) < a.hmacNonceLength {
+		return ErrHMACMismatch
 	}
+	nonce := expected[:a.hmacNonceLength]
+	h := a.getHMAC()
+	defer a.hmacPool.Put(h)
+	h.Write(nonce)
+	h.Write(msg)
 
-	calculatedMAC, err := a.calcHMAC(nonce, msg)
-	if err != nil {
-		return err
-	}
-	if !hmac.Equal(calculatedMAC, expected) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = h.Sum(append(*buf, nonce...))
+	if !hmac.Equal(*buf, expected) {
 		return ErrHMACMismatch
 	}
 	return nil
 }
 
-func (a *Authenticator) calcHMAC(nonce, msg []byte) ([]byte, error) {
-	defer a.hmac.Reset()
+// calcNonceHMAC returns nonce followed by HMAC-SHA256 of nonce and msg.
+func calcNonceHMAC(key, nonce, msg []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(nonce)
+	mac.Write(msg)
+	result := make([]byte, 0, len(nonce)+mac.Size())
+	result = append(result, nonce...)
+	return mac.Sum(result)
+}
 
-	n, err := a.hmac.Write(append(nonce, msg...))
-	if err != nil || n == 0 {
-		return nil, fmt.Errorf("unable to write to hmac: %w", err)
+// encryptBase64 encrypts secret with a, using its own text representation if a
+// implements Base64Authenticator, otherwise encodes the ciphertext with RawURLEncoding.
+func encryptBase64(a Authenticator, secret []byte) ([]byte, error) {
+	if ba, ok := a.(Base64Authenticator); ok {
+		return ba.EncryptBase64(secret)
+	}
+	ciphertext, err := a.Encrypt(secret)
+	if err != nil {
+		return nil, err
 	}
+	return encodeBase64(ciphertext), nil
+}
 
-	sum := a.hmac.Sum(nil)
+// decryptBase64 is the counterpart of encryptBase64.
+func decryptBase64(a Authenticator, b64 []byte) ([]byte, error) {
+	if ba, ok := a.(Base64Authenticator); ok {
+		return ba.DecryptBase64(b64)
+	}
+	ciphertext, err := decodeBase64(b64)
+	if err != nil {
+		return nil, err
+	}
+	return a.Decrypt(ciphertext)
+}
 
-	result := append(nonce, sum...)
-	return result, nil
+func encodeBase64(ciphertext []byte) []byte {
+	b64 := make([]byte, base64.RawURLEncoding.EncodedLen(len(ciphertext)))
+	base64.RawURLEncoding.Encode(b64, ciphertext)
+	return b64
+}
+
+func decodeBase64(b64 []byte) ([]byte, error) {
+	ciphertext := make([]byte, base64.RawURLEncoding.DecodedLen(len(b64)))
+	if _, err := base64.RawURLEncoding.Decode(ciphertext, b64); err != nil {
+		return nil, err
+	}
+	return ciphertext, nil
 }
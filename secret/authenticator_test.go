@@ -6,7 +6,7 @@ const (
 	testStringKey = "955880d5f4f43c66751848c06fedb78e420995b373418dcfb856ca559deb71c3"
 )
 
-func getAuth() *Authenticator {
+func getAuth() *AESGCM {
 	key, err := KeyFromString(testStringKey)
 	if err != nil {
 		panic(err)
@@ -0,0 +1,117 @@
+package secret
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Ciphertexts are randomized by their nonce, therefore encrypted columns cannot be
+// searched. Blind indexes are keyed hashes of (normalized) plaintexts, which can be
+// stored and indexed next to the ciphertexts, and looked up by computing the blind
+// index of the searched value.
+//
+// Blind indexes reveal which rows share the same value, and truncating them to fewer
+// bits trades more false positives in lookups (which should be filtered by comparing
+// the decrypted values) for less certainty of equality, see WithBlindIndexBits.
+
+// DefaultBlindIndexBits is the length of blind indexes, unless configured.
+const DefaultBlindIndexBits = 256
+
+// BlindIndexOption configures optional behavior of a blind index.
+type BlindIndexOption func(*BlindIndex) error
+
+// WithBlindIndexBits truncates blind indexes to n bits, between 1 and 256. Blind
+// indexes of n bits collide for about 1 of 2^n distinct values, which should exceed the
+// number of rows for lookups to be efficient, yet remain low enough that equal indexes
+// do not imply equal values with certainty.
+func WithBlindIndexBits(n int) BlindIndexOption {
+	return func(b *BlindIndex) error {
+		if n < 1 || n > sha256.Size*8 {
+			return fmt.Errorf("blind index bits must be between 1 and %d: %d", sha256.Size*8, n)
+		}
+		b.bits = n
+		return nil
+	}
+}
+
+// WithNormalizers configures functions applied (in order) to values before they are
+// indexed, so that equivalent values (e.g. emails in different case) share the index.
+func WithNormalizers(normalizers ...func(string) string) BlindIndexOption {
+	return func(b *BlindIndex) error {
+		b.normalizers = append(b.normalizers, normalizers...)
+		return nil
+	}
+}
+
+// Normalizers for WithNormalizers.
+var (
+	NormalizeLower     = strings.ToLower
+	NormalizeTrimSpace = strings.TrimSpace
+)
+
+// NormalizeDigits removes everything but digits, e.g. from phone or social security numbers.
+func NormalizeDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// BlindIndex computes blind indexes of a column.
+type BlindIndex struct {
+	key         []byte
+	bits        int
+	normalizers []func(string) string
+}
+
+// NewBlindIndex returns BlindIndex of column name (e.g. "users.email"). key must be at
+// least 32 bytes and separate from encryption keys. Each column derives its own key
+// from it, therefore indexes of different columns are unrelated.
+func NewBlindIndex(key []byte, name string, opts ...BlindIndexOption) (*BlindIndex, error) {
+	if len(key) < AES256KeyLength {
+		return nil, fmt.Errorf("blind index key must be at least %d bytes, received %d", AES256KeyLength, len(key))
+	}
+	if name == "" {
+		return nil, fmt.Errorf("blind index name is required")
+	}
+	b := &BlindIndex{
+		key:  hkdf(sha256.New, key, nil, []byte("secret-blind-index:"+name), sha256.Size),
+		bits: DefaultBlindIndexBits,
+	}
+	for _, opt := range opts {
+		if err := opt(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Compute returns blind index of normalized value, which is Bits rounded up to
+// bytes long, with unused trailing bits set to zero.
+func (b *BlindIndex) Compute(value string) []byte {
+	for _, normalize := range b.normalizers {
+		value = normalize(value)
+	}
+	mac := hmac.New(sha256.New, b.key)
+	mac.Write([]byte(value))
+	index := mac.Sum(nil)[:(b.bits+7)/8]
+	if rem := b.bits % 8; rem != 0 {
+		index[len(index)-1] &= 0xff << (8 - rem)
+	}
+	return index
+}
+
+// ComputeString returns blind index of plaintext of s, see Compute.
+func (b *BlindIndex) ComputeString(s String) []byte {
+	return b.Compute(s.Value())
+}
+
+// Bits returns length of blind indexes in bits.
+func (b *BlindIndex) Bits() int {
+	return b.bits
+}
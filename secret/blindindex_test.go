@@ -0,0 +1,118 @@
+package secret
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func getBlindIndexKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := KeyFromString("955880d5f4f43c66751848c06fedb78e420995b373418dcfb856ca559deb71c3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestBlindIndex(t *testing.T) {
+	key := getBlindIndexKey(t)
+	email, err := NewBlindIndex(key, "users.email", WithNormalizers(NormalizeTrimSpace, NormalizeLower))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := email.Compute("kirby@dreamland.example")
+	if len(index) != DefaultBlindIndexBits/8 {
+		t.Fatalf("unexpected index length: %d", len(index))
+	}
+	for _, equivalent := range []string{" Kirby@Dreamland.example", "KIRBY@DREAMLAND.EXAMPLE\n"} {
+		if !bytes.Equal(index, email.Compute(equivalent)) {
+			t.Fatalf("%q: unexpected index", equivalent)
+		}
+	}
+	if !bytes.Equal(index, email.ComputeString(NewString("kirby@dreamland.example"))) {
+		t.Fatal("unexpected index of String")
+	}
+	if bytes.Equal(index, email.Compute("meta.knight@dreamland.example")) {
+		t.Fatal("indexes of different values are unexpectedly equal")
+	}
+
+	// Indexes of different columns, or with different keys, are unrelated.
+	other, err := NewBlindIndex(key, "users.backup_email", WithNormalizers(NormalizeTrimSpace, NormalizeLower))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(index, other.Compute("kirby@dreamland.example")) {
+		t.Fatal("indexes of different columns are unexpectedly equal")
+	}
+	otherKey := append([]byte(nil), key...)
+	otherKey[0] ^= 1
+	if other, err = NewBlindIndex(otherKey, "users.email", WithNormalizers(NormalizeTrimSpace, NormalizeLower)); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(index, other.Compute("kirby@dreamland.example")) {
+		t.Fatal("indexes with different keys are unexpectedly equal")
+	}
+
+	ssn, err := NewBlindIndex(key, "users.ssn", WithNormalizers(NormalizeDigits))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ssn.Compute("078-05-1120"), ssn.Compute("078 05 1120")) {
+		t.Fatal("indexes of equivalent ssn are unexpectedly unequal")
+	}
+}
+
+func TestBlindIndexBits(t *testing.T) {
+	key := getBlindIndexKey(t)
+	full, err := NewBlindIndex(key, "users.ssn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bits := range []int{1, 12, 16, 32, 255} {
+		truncated, err := NewBlindIndex(key, "users.ssn", WithBlindIndexBits(bits))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if truncated.Bits() != bits {
+			t.Fatalf("unexpected bits: %d", truncated.Bits())
+		}
+		for i := 0; i < 16; i++ {
+			value := fmt.Sprintf("078-05-%04d", i)
+			expected, actual := full.Compute(value), truncated.Compute(value)
+			if len(actual) != (bits+7)/8 {
+				t.Fatalf("%d bits: unexpected index length: %d", bits, len(actual))
+			}
+			// Truncated index is a prefix of the full one, with unused bits cleared.
+			last := len(actual) - 1
+			if !bytes.Equal(actual[:last], expected[:last]) || actual[last] != expected[last]&(0xff<<((8-bits%8)%8)) {
+				t.Fatalf("%d bits: %x is not truncated from %x", bits, actual, expected)
+			}
+		}
+	}
+
+	// Few bits collide often.
+	oneBit, err := NewBlindIndex(key, "users.ssn", WithBlindIndexBits(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 16; i++ {
+		seen[string(oneBit.Compute(fmt.Sprint(i)))] = true
+	}
+	if len(seen) > 2 {
+		t.Fatalf("unexpected number of distinct 1-bit indexes: %d", len(seen))
+	}
+
+	for _, invalid := range []int{0, -1, 257} {
+		if _, err := NewBlindIndex(key, "users.ssn", WithBlindIndexBits(invalid)); err == nil {
+			t.Fatalf("%d bits were unexpectedly accepted", invalid)
+		}
+	}
+	if _, err := NewBlindIndex(key[:16], "users.ssn"); err == nil {
+		t.Fatal("short key was unexpectedly accepted")
+	}
+	if _, err := NewBlindIndex(key, ""); err == nil {
+		t.Fatal("empty name was unexpectedly accepted")
+	}
+}
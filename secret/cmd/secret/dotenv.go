@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"go.husin.dev/x/secret"
+)
+
+func dotenv(args []string) error {
+	flags := flag.NewFlagSet("dotenv", flag.ExitOnError)
+	keyFile := flags.String("key-file", "", "path to file containing hex-encoded key")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: secret dotenv [-key-file file] encrypt|decrypt <path>")
+	}
+	auth, err := loadAuthenticator(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	switch action, path := flags.Arg(0), flags.Arg(1); action {
+	case "encrypt":
+		return secret.EncryptDotenvFile(auth, path)
+	case "decrypt":
+		return secret.DecryptDotenvFile(auth, path)
+	default:
+		return fmt.Errorf("unknown dotenv action: %s", action)
+	}
+}
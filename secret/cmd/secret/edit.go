@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"go.husin.dev/x/secret"
+)
+
+func edit(args []string) error {
+	flags := flag.NewFlagSet("edit", flag.ExitOnError)
+	keyFile := flags.String("key-file", "", "path to file containing hex-encoded key")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: secret edit [-key-file file] <path>")
+	}
+	auth, err := loadAuthenticator(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	// Terminating the process cancels ctx, so that the decrypted file is wiped.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGHUP)
+	defer stop()
+	// Interrupt is delivered to the editor as well, which decides whether to exit.
+	signal.Ignore(os.Interrupt)
+	defer signal.Reset(os.Interrupt)
+
+	return secret.EditCredentials(ctx, auth, flags.Arg(0), runEditor)
+}
+
+func runEditor(ctx context.Context, path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// Editor may contain arguments, e.g. "code --wait".
+	fields := strings.Fields(editor)
+	cmd := exec.CommandContext(ctx, fields[0], append(fields[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+func loadAuthenticator(keyFile string) (secret.Authenticator, error) {
+	str := os.Getenv("SECRET_KEY")
+	if keyFile != "" {
+		b, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		str = string(b)
+	}
+	if str == "" {
+		return nil, fmt.Errorf("missing key: use -key-file or set SECRET_KEY")
+	}
+	key, err := secret.KeyFromString(strings.TrimSpace(str))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode key: %w", err)
+	}
+	return secret.NewAuthenticatorAESGCM(key)
+}
@@ -0,0 +1,79 @@
+// Command secret provides utilities to work with values produced by
+// go.husin.dev/x/secret.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"go.husin.dev/x/secret"
+)
+
+const usage = `Usage: secret <command> [arguments]
+
+Commands:
+  inspect [value...]    report structure of ciphertexts or MACs (read from stdin if omitted)
+  edit [-key-file file] <path>
+                        edit encrypted credentials file in $EDITOR
+  dotenv [-key-file file] encrypt|decrypt <path>
+                        encrypt or decrypt values of dotenv file in place
+
+Commands which require a key read it (hex-encoded) from -key-file, otherwise
+from SECRET_KEY environment variable.
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "inspect":
+		err = inspect(os.Stdin, os.Stdout, args)
+	case "edit":
+		err = edit(args)
+	case "dotenv":
+		err = dotenv(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", cmd)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func inspect(stdin io.Reader, stdout io.Writer, values []string) error {
+	if len(values) == 0 {
+		scanner := bufio.NewScanner(stdin)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			if len(scanner.Bytes()) > 0 {
+				values = append(values, scanner.Text())
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	for i, value := range values {
+		if i > 0 {
+			fmt.Fprintln(stdout)
+		}
+		result, err := secret.Inspect([]byte(value))
+		if err != nil {
+			return fmt.Errorf("unable to inspect %q: %w", value, err)
+		}
+		fmt.Fprint(stdout, result)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	input, err := os.ReadFile("testdata/inspect.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile("testdata/inspect.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Values are read from stdin, skipping blank lines.
+	var stdout bytes.Buffer
+	if err := inspect(bytes.NewReader(input), &stdout, nil); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != string(expected) {
+		t.Fatalf("unexpected output, expecting:\n%s\nreceived:\n%s", expected, stdout.String())
+	}
+
+	// Arguments take precedence over stdin.
+	stdout.Reset()
+	values := strings.Fields(string(input))
+	if err := inspect(strings.NewReader("poyo"), &stdout, values); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != string(expected) {
+		t.Fatalf("unexpected output, expecting:\n%s\nreceived:\n%s", expected, stdout.String())
+	}
+
+	if err := inspect(nil, &stdout, []string{"poyo"}); err == nil {
+		t.Fatal("invalid value was unexpectedly inspected")
+	}
+}
@@ -0,0 +1,168 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Credentials file is a single encrypted JSON document of application secrets,
+// inspired by "credentials.yml.enc" in Rails. The file contains the JSON document
+// encrypted by EncryptBase64, therefore is safe to be committed to version control.
+
+// ReadCredentials decrypts credentials file at path with auth and returns the JSON document.
+func ReadCredentials(auth Authenticator, path string) ([]byte, error) {
+	ciphertext, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := decryptBase64(auth, bytes.TrimSpace(ciphertext))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt credentials %s: %w", path, err)
+	}
+	return plaintext, nil
+}
+
+// WriteCredentials encrypts JSON document with auth and atomically replaces the
+// credentials file at path.
+func WriteCredentials(auth Authenticator, path string, plaintext []byte) error {
+	if !json.Valid(plaintext) {
+		return fmt.Errorf("unable to write credentials %s: %w: content is not valid JSON", path, ErrInvalidCredentials)
+	}
+	ciphertext, err := encryptBase64(auth, plaintext)
+	if err != nil {
+		return fmt.Errorf("unable to encrypt credentials %s: %w", path, err)
+	}
+	return writeFileAtomic(path, append(ciphertext, '\n'))
+}
+
+// writeFileAtomic replaces file at path with data, so that readers never observe
+// partially written content.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadCredentials decrypts credentials file at path with auth and decodes the JSON
+// document into v, typically a pointer to struct.
+func LoadCredentials(auth Authenticator, path string, v any) error {
+	plaintext, err := ReadCredentials(auth, path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(plaintext, v); err != nil {
+		return fmt.Errorf("unable to decode credentials %s: %w", path, err)
+	}
+	return nil
+}
+
+// SaveCredentials encodes v as JSON document and writes it to credentials file at
+// path, encrypted with auth.
+func SaveCredentials(auth Authenticator, path string, v any) error {
+	plaintext, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode credentials %s: %w", path, err)
+	}
+	return WriteCredentials(auth, path, plaintext)
+}
+
+// credentialsRecoverySuffix is appended to path of credentials file, to keep encrypted
+// edits which could not be saved.
+const credentialsRecoverySuffix = ".recovery"
+
+// EditCredentials decrypts credentials file at path (or starts with an empty JSON
+// object, if the file does not exist) to a temporary file, which is passed to edit,
+// e.g. to open it in $EDITOR. Once edit returns, the content is encrypted back to
+// path if it has changed.
+//
+// The temporary file is wiped once EditCredentials returns, including when edit
+// fails or panics, or ctx is canceled (e.g. on interrupt signal). If the edited content
+// cannot be saved (e.g. invalid JSON), it is encrypted to a recovery file next to path
+// instead, so that edits are not lost, and the next EditCredentials resumes from it.
+func EditCredentials(ctx context.Context, auth Authenticator, path string, edit func(ctx context.Context, path string) error) error {
+	recovery := path + credentialsRecoverySuffix
+	plaintext, err := ReadCredentials(auth, recovery)
+	recovered := err == nil
+	if errors.Is(err, fs.ErrNotExist) {
+		plaintext, err = ReadCredentials(auth, path)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		plaintext, err = []byte("{\n}\n"), nil
+	}
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "secret-credentials-*")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, filepath.Base(path)+".json")
+	defer wipe(dir, tmp)
+	if err := os.WriteFile(tmp, plaintext, 0o600); err != nil {
+		return err
+	}
+
+	if err := edit(ctx, tmp); err != nil {
+		return fmt.Errorf("unable to edit credentials: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("unable to edit credentials: %w", err)
+	}
+
+	edited, err := os.ReadFile(tmp)
+	if err != nil {
+		return err
+	}
+	// Recovered edits are saved even if unchanged, as they differ from path.
+	if !recovered && bytes.Equal(plaintext, edited) {
+		return nil
+	}
+	if err := WriteCredentials(auth, path, edited); err != nil {
+		ciphertext, encryptErr := encryptBase64(auth, edited)
+		if encryptErr == nil {
+			encryptErr = writeFileAtomic(recovery, append(ciphertext, '\n'))
+		}
+		if encryptErr != nil {
+			return fmt.Errorf("%w (edits are lost, unable to write %s: %v)", err, recovery, encryptErr)
+		}
+		return fmt.Errorf("%w (edits are kept encrypted in %s, and resumed by the next edit)", err, recovery)
+	}
+	if recovered {
+		return os.Remove(recovery)
+	}
+	return nil
+}
+
+// wipe overwrites file with zeroes before removing it along with its directory,
+// so that plaintext does not linger on disk.
+func wipe(dir, file string) {
+	if info, err := os.Stat(file); err == nil {
+		if f, err := os.OpenFile(file, os.O_WRONLY, 0); err == nil {
+			f.Write(make([]byte, info.Size()))
+			f.Sync()
+			f.Close()
+		}
+	}
+	os.RemoveAll(dir)
+}
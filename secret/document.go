@@ -0,0 +1,354 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Partial encryption of JSON documents is inspired by SOPS: only values are encrypted,
+// while the structure and keys remain readable. Each encrypted value is bound to its
+// location (JSON Pointer, RFC 6901) as additional data, and a MAC over the whole
+// document, stored under "_secret" key, detects swapped, modified, or deleted values.
+
+var (
+	ErrInvalidDocument = errors.New("invalid document")
+)
+
+const (
+	documentMetadataKey     = "_secret"
+	documentEncryptedPrefix = "ENC["
+	documentEncryptedSuffix = "]"
+)
+
+// DocumentOptions selects which values of a document are encrypted by EncryptDocument.
+// Expressions match key names of objects, selecting all values nested under the key.
+type DocumentOptions struct {
+	// EncryptedKeys selects values to be encrypted. If nil, all values are encrypted.
+	EncryptedKeys *regexp.Regexp
+	// UnencryptedKeys excludes values from encryption, taking precedence over EncryptedKeys.
+	UnencryptedKeys *regexp.Regexp
+}
+
+func (o *DocumentOptions) selects(keys []string) bool {
+	if o == nil {
+		return true
+	}
+	selected := o.EncryptedKeys == nil
+	for _, k := range keys {
+		if o.UnencryptedKeys != nil && o.UnencryptedKeys.MatchString(k) {
+			return false
+		}
+		if o.EncryptedKeys != nil && o.EncryptedKeys.MatchString(k) {
+			selected = true
+		}
+	}
+	return selected
+}
+
+// documentMetadata is stored under documentMetadataKey of encrypted documents.
+type documentMetadata struct {
+	MAC string `json:"mac"`
+}
+
+// documentNode is a JSON value which retains order of object keys.
+type documentNode struct {
+	// kind is '{' for objects, '[' for arrays, or zero for other values.
+	kind     byte
+	keys     []string
+	children []*documentNode
+	// value is JSON encoding of values other than objects and arrays.
+	value []byte
+}
+
+// EncryptDocument encrypts values of JSON object doc selected by opts (or all values,
+// if opts is nil), leaving keys and unselected values readable. Values are encrypted
+// with their types (e.g. numbers remain numbers once decrypted), and replaced with
+// strings formatted as "ENC[...]". Values which were already encrypted are kept as is,
+// therefore an unmodified encrypted document can be encrypted again with a broader
+// selection; its MAC is verified first. Plaintext strings formatted as "ENC[...]" are
+// refused, as they cannot be told apart from encrypted values.
+//
+// Authenticator must implement AdditionalDataAuthenticator.
+func EncryptDocument(auth Authenticator, doc []byte, opts *DocumentOptions) ([]byte, error) {
+	ada, ok := auth.(AdditionalDataAuthenticator)
+	if !ok {
+		return nil, fmt.Errorf("authenticator %T does not support additional data", auth)
+	}
+	root, metadata, err := parseEncryptedDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	if metadata != nil {
+		if err := checkDocumentMAC(auth, root, metadata); err != nil {
+			return nil, fmt.Errorf("unable to verify encrypted document (decrypt the document to modify it): %w", err)
+		}
+	} else {
+		err := walkDocument(root, "", nil, func(n *documentNode, pointer string, _ []string) error {
+			if _, ok := documentCiphertext(n); ok {
+				return fmt.Errorf("%w: %s: value is formatted as encrypted, but document has no MAC", ErrInvalidDocument, pointer)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = walkDocument(root, "", nil, func(n *documentNode, pointer string, keys []string) error {
+		if n.kind != 0 || !opts.selects(keys) {
+			return nil
+		}
+		if _, ok := documentCiphertext(n); ok {
+			return nil
+		}
+		ciphertext, err := ada.EncryptWithAdditionalData(n.value, []byte(pointer))
+		if err != nil {
+			return fmt.Errorf("unable to encrypt %s: %w", pointer, err)
+		}
+		n.value = encodeDocumentString(documentEncryptedPrefix + string(encodeBase64(ciphertext)) + documentEncryptedSuffix)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mac, err := auth.HMAC(documentMACMessage(root))
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(documentMetadata{MAC: string(encodeBase64(mac))})
+	if err != nil {
+		return nil, err
+	}
+	root.keys = append(root.keys, documentMetadataKey)
+	root.children = append(root.children, &documentNode{value: encoded})
+	return formatDocument(root)
+}
+
+// DecryptDocument verifies MAC of JSON document encrypted by EncryptDocument, then
+// returns the document with decrypted values.
+func DecryptDocument(auth Authenticator, doc []byte) ([]byte, error) {
+	ada, ok := auth.(AdditionalDataAuthenticator)
+	if !ok {
+		return nil, fmt.Errorf("authenticator %T does not support additional data", auth)
+	}
+	root, metadata, err := parseEncryptedDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	if metadata == nil {
+		return nil, fmt.Errorf("%w: missing %q, document is not encrypted by EncryptDocument", ErrInvalidDocument, documentMetadataKey)
+	}
+	if err := checkDocumentMAC(auth, root, metadata); err != nil {
+		return nil, err
+	}
+
+	err = walkDocument(root, "", nil, func(n *documentNode, pointer string, _ []string) error {
+		b64, ok := documentCiphertext(n)
+		if !ok {
+			return nil
+		}
+		ciphertext, err := decodeBase64([]byte(b64))
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidDocument, pointer, err)
+		}
+		value, err := ada.DecryptWithAdditionalData(ciphertext, []byte(pointer))
+		if err != nil {
+			return fmt.Errorf("unable to decrypt %s: %w", pointer, err)
+		}
+		if !json.Valid(value) {
+			return fmt.Errorf("%w: %s: decrypted value is not valid JSON", ErrInvalidDocument, pointer)
+		}
+		n.value = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return formatDocument(root)
+}
+
+func checkDocumentMAC(auth Authenticator, root *documentNode, metadata *documentMetadata) error {
+	mac, err := decodeBase64([]byte(metadata.MAC))
+	if err != nil {
+		return fmt.Errorf("%w: invalid MAC: %v", ErrInvalidDocument, err)
+	}
+	return auth.HMACCheck(documentMACMessage(root), mac)
+}
+
+// parseEncryptedDocument parses JSON object doc, returning it without its metadata,
+// which is nil if doc has not been encrypted.
+func parseEncryptedDocument(doc []byte) (*documentNode, *documentMetadata, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	root, err := parseDocument(dec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, nil, fmt.Errorf("%w: unexpected data after top-level value", ErrInvalidDocument)
+	}
+	if root.kind != '{' {
+		return nil, nil, fmt.Errorf("%w: top-level value must be an object", ErrInvalidDocument)
+	}
+
+	var metadata *documentMetadata
+	for i, k := range root.keys {
+		if k != documentMetadataKey {
+			continue
+		}
+		var raw bytes.Buffer
+		writeDocument(&raw, root.children[i])
+		metadata = &documentMetadata{}
+		if err := json.Unmarshal(raw.Bytes(), metadata); err != nil {
+			return nil, nil, fmt.Errorf("%w: invalid %q: %v", ErrInvalidDocument, documentMetadataKey, err)
+		}
+		root.keys = append(root.keys[:i], root.keys[i+1:]...)
+		root.children = append(root.children[:i], root.children[i+1:]...)
+		break
+	}
+	return root, metadata, nil
+}
+
+func parseDocument(dec *json.Decoder) (*documentNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		value, err := json.Marshal(tok)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := tok.(string); ok {
+			value = encodeDocumentString(s)
+		}
+		return &documentNode{value: value}, nil
+	}
+
+	n := &documentNode{kind: byte(delim)}
+	for dec.More() {
+		if n.kind == '{' {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			n.keys = append(n.keys, key.(string))
+		}
+		child, err := parseDocument(dec)
+		if err != nil {
+			return nil, err
+		}
+		n.children = append(n.children, child)
+	}
+	// Closing delimiter.
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// walkDocument calls fn for n and all of its descendants in document order, with their
+// JSON Pointer and keys of objects they are nested under.
+func walkDocument(n *documentNode, pointer string, keys []string, fn func(n *documentNode, pointer string, keys []string) error) error {
+	if err := fn(n, pointer, keys); err != nil {
+		return err
+	}
+	for i, child := range n.children {
+		token := strconv.Itoa(i)
+		childKeys := keys
+		if n.kind == '{' {
+			token = n.keys[i]
+			childKeys = append(keys[:len(keys):len(keys)], n.keys[i])
+		}
+		token = strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+		if err := walkDocument(child, pointer+"/"+token, childKeys, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// documentCiphertext returns Base64-encoded ciphertext of value encrypted by EncryptDocument.
+func documentCiphertext(n *documentNode) (string, bool) {
+	if n.kind != 0 || len(n.value) == 0 || n.value[0] != '"' {
+		return "", false
+	}
+	var s string
+	if json.Unmarshal(n.value, &s) != nil {
+		return "", false
+	}
+	if !strings.HasPrefix(s, documentEncryptedPrefix) || !strings.HasSuffix(s, documentEncryptedSuffix) {
+		return "", false
+	}
+	return s[len(documentEncryptedPrefix) : len(s)-len(documentEncryptedSuffix)], true
+}
+
+// documentMACMessage serializes all nodes in document order, so that their MAC changes
+// when values are modified, moved, or deleted.
+func documentMACMessage(root *documentNode) []byte {
+	var b bytes.Buffer
+	walkDocument(root, "", nil, func(n *documentNode, pointer string, _ []string) error {
+		value := n.value
+		if n.kind != 0 {
+			value = []byte{n.kind}
+		}
+		writeMACEntry(&b, pointer, value)
+		return nil
+	})
+	return b.Bytes()
+}
+
+func formatDocument(root *documentNode) ([]byte, error) {
+	var compact bytes.Buffer
+	writeDocument(&compact, root)
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, compact.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	indented.WriteByte('\n')
+	return indented.Bytes(), nil
+}
+
+func writeDocument(b *bytes.Buffer, n *documentNode) {
+	switch n.kind {
+	case '{':
+		b.WriteByte('{')
+		for i, child := range n.children {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.Write(encodeDocumentString(n.keys[i]))
+			b.WriteByte(':')
+			writeDocument(b, child)
+		}
+		b.WriteByte('}')
+	case '[':
+		b.WriteByte('[')
+		for i, child := range n.children {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeDocument(b, child)
+		}
+		b.WriteByte(']')
+	default:
+		b.Write(n.value)
+	}
+}
+
+// encodeDocumentString encodes s as JSON string, without escaping HTML characters.
+func encodeDocumentString(s string) []byte {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+}
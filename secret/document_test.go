@@ -0,0 +1,232 @@
+package secret
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const testDocument = `{
+  "name": "dreamland",
+  "database": {
+    "host": "localhost",
+    "port": 5432,
+    "password": "carby<&>"
+  },
+  "api_keys": [
+    "poyo",
+    "kirby"
+  ],
+  "debug": true,
+  "owner": null
+}
+`
+
+func TestDocumentEncryptDecrypt(t *testing.T) {
+	auth := getAuth()
+	encrypted, err := EncryptDocument(auth, []byte(testDocument), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("encrypted:\n%s", encrypted)
+	for _, plaintext := range []string{"dreamland", "localhost", "5432", "carby", "poyo", "true", "null"} {
+		if strings.Contains(string(encrypted), plaintext) {
+			t.Fatalf("encrypted document contains %q", plaintext)
+		}
+	}
+	for _, readable := range []string{`"database"`, `"password": "ENC[`, `"api_keys"`, `"_secret"`} {
+		if !strings.Contains(string(encrypted), readable) {
+			t.Fatalf("encrypted document is missing %s", readable)
+		}
+	}
+
+	decrypted, err := DecryptDocument(auth, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != testDocument {
+		t.Fatalf("unequal:\n\tsrc: %s\n\tdst: %s\n", testDocument, decrypted)
+	}
+}
+
+func TestDocumentSelectors(t *testing.T) {
+	auth := getAuth()
+	opts := &DocumentOptions{
+		EncryptedKeys:   regexp.MustCompile(`^(database|api_keys)$`),
+		UnencryptedKeys: regexp.MustCompile(`^(host|port)$`),
+	}
+	encrypted, err := EncryptDocument(auth, []byte(testDocument), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(encrypted, &doc); err != nil {
+		t.Fatal(err)
+	}
+	database := doc["database"].(map[string]any)
+	isEncrypted := func(v any) bool {
+		s, ok := v.(string)
+		return ok && strings.HasPrefix(s, "ENC[")
+	}
+	for name, tc := range map[string]struct {
+		value     any
+		encrypted bool
+	}{
+		"name":              {doc["name"], false},
+		"debug":             {doc["debug"], false},
+		"database.host":     {database["host"], false},
+		"database.port":     {database["port"], false},
+		"database.password": {database["password"], true},
+		"api_keys[0]":       {doc["api_keys"].([]any)[0], true},
+	} {
+		if isEncrypted(tc.value) != tc.encrypted {
+			t.Fatalf("%s: unexpected value %v, expecting encrypted: %t", name, tc.value, tc.encrypted)
+		}
+	}
+
+	// Encrypting again with broader selection encrypts remaining values only.
+	again, err := EncryptDocument(auth, encrypted, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(again), database["password"].(string)) {
+		t.Fatal("existing ciphertext was not kept")
+	}
+	decrypted, err := DecryptDocument(auth, again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != testDocument {
+		t.Fatalf("unequal:\n\tsrc: %s\n\tdst: %s\n", testDocument, decrypted)
+	}
+}
+
+func TestDocumentTampered(t *testing.T) {
+	auth := getAuth()
+	encrypted, err := EncryptDocument(auth, []byte(`{"a":"1","b":"2","c":{"d":3}}`), &DocumentOptions{
+		UnencryptedKeys: regexp.MustCompile(`^d$`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(encrypted, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tamper := func(fn func(doc map[string]any)) []byte {
+		copied := map[string]any{}
+		for k, v := range doc {
+			copied[k] = v
+		}
+		fn(copied)
+		b, err := json.Marshal(copied)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	for name, tampered := range map[string][]byte{
+		"swapped":  tamper(func(doc map[string]any) { doc["a"], doc["b"] = doc["b"], doc["a"] }),
+		"deleted":  tamper(func(doc map[string]any) { delete(doc, "b") }),
+		"modified": tamper(func(doc map[string]any) { doc["c"] = map[string]any{"d": 4} }),
+		"added":    tamper(func(doc map[string]any) { doc["e"] = "5" }),
+	} {
+		if _, err := DecryptDocument(auth, tampered); !errors.Is(err, ErrHMACMismatch) {
+			t.Fatalf("%s: expecting ErrHMACMismatch, but received %v", name, err)
+		}
+	}
+
+	// Tampered documents are not encrypted again under a new MAC.
+	for name, tampered := range map[string][]byte{
+		"swapped": tamper(func(doc map[string]any) { doc["a"], doc["b"] = doc["b"], doc["a"] }),
+		"deleted": tamper(func(doc map[string]any) { delete(doc, "b") }),
+		"added":   tamper(func(doc map[string]any) { doc["e"] = doc["a"] }),
+	} {
+		if _, err := EncryptDocument(auth, tampered, nil); !errors.Is(err, ErrHMACMismatch) {
+			t.Fatalf("%s: expecting ErrHMACMismatch, but received %v", name, err)
+		}
+	}
+
+	// Documents without MAC are refused, as well as encrypted values without MAC.
+	withoutMAC := tamper(func(doc map[string]any) { delete(doc, documentMetadataKey) })
+	if _, err := DecryptDocument(auth, withoutMAC); !errors.Is(err, ErrInvalidDocument) {
+		t.Fatalf("expecting ErrInvalidDocument, but received %v", err)
+	}
+	for _, doc := range [][]byte{withoutMAC, []byte(`{"a":"ENC[poyo]"}`)} {
+		if _, err := EncryptDocument(auth, doc, nil); !errors.Is(err, ErrInvalidDocument) {
+			t.Fatalf("expecting ErrInvalidDocument, but received %v", err)
+		}
+	}
+}
+
+func TestDocumentAdditionalData(t *testing.T) {
+	auth := getAuth()
+	encrypted, err := EncryptDocument(auth, []byte(`{"a":"1","b":"2"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(encrypted, &doc); err != nil {
+		t.Fatal(err)
+	}
+	// Forge MAC over swapped values, which should still be refused by their additional data.
+	doc["a"], doc["b"] = doc["b"], doc["a"]
+	delete(doc, documentMetadataKey)
+	swapped, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _, err := parseEncryptedDocument(swapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac, err := auth.HMAC(documentMACMessage(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc[documentMetadataKey] = documentMetadata{MAC: string(encodeBase64(mac))}
+	forged, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptDocument(auth, forged); err == nil || !strings.Contains(err.Error(), "/a") {
+		t.Fatalf("swapped value was unexpectedly accepted: %v", err)
+	}
+}
+
+func TestDocumentInvalid(t *testing.T) {
+	auth := getAuth()
+	for _, doc := range []string{`[1, 2]`, `"poyo"`, `{"a":1} {"b":2}`, `{"a":`} {
+		if _, err := EncryptDocument(auth, []byte(doc), nil); !errors.Is(err, ErrInvalidDocument) {
+			t.Fatalf("%s: expecting ErrInvalidDocument, but received %v", doc, err)
+		}
+	}
+	if _, err := EncryptDocument(reverseAuth{}, []byte(`{}`), nil); err == nil {
+		t.Fatal("authenticator without additional data was unexpectedly accepted")
+	}
+}
+
+func TestDocumentEscapedKeys(t *testing.T) {
+	auth := getAuth()
+	var decoded map[string]any
+	encrypted, err := EncryptDocument(auth, []byte(`{"a/b":{"~c":[1]}}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := DecryptDocument(auth, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(decrypted, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"a/b": map[string]any{"~c": []any{float64(1)}}}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("unexpected document: %v", decoded)
+	}
+}
@@ -0,0 +1,320 @@
+package secret
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// dotenvEncryptedPrefix marks values encrypted by EncryptDotenv.
+	dotenvEncryptedPrefix = "encrypted:"
+	// dotenvMACPrefix marks the comment which holds MAC of all entries, so that
+	// reordered or deleted entries are detected.
+	dotenvMACPrefix = "# secret-mac: "
+)
+
+var dotenvEntry = regexp.MustCompile(`^(\s*(?:export\s+)?([A-Za-z_][A-Za-z0-9_.]*)\s*=)(.*)$`)
+
+type dotenvLine struct {
+	// text is the original line(s), used as is for comments and blank lines.
+	text string
+	// prefix is everything up to and including "=" (e.g. "export KEY=").
+	prefix string
+	key    string
+	// value is raw value, including quotes and inline comments.
+	value string
+}
+
+func (l dotenvLine) isEntry() bool {
+	return l.key != ""
+}
+
+// EncryptDotenv encrypts values of dotenv document src with EncryptBase64, while keys,
+// comments, and ordering remain readable for diffs. Values which were already encrypted
+// are kept as is, therefore new entries can be added to encrypted document and encrypted
+// again, as long as existing MAC still verifies encrypted entries (i.e. they were not
+// modified, reordered, or deleted). A MAC over all entries is appended, which is verified
+// by DecryptDotenv.
+func EncryptDotenv(auth Authenticator, src []byte) ([]byte, error) {
+	lines, err := parseDotenv(src)
+	if err != nil {
+		return nil, err
+	}
+	lines, mac, err := extractDotenvMAC(lines)
+	if err != nil {
+		return nil, err
+	}
+	var encrypted []dotenvLine
+	for _, l := range lines {
+		if l.isEntry() && strings.HasPrefix(l.value, dotenvEncryptedPrefix) {
+			encrypted = append(encrypted, l)
+		}
+	}
+	switch {
+	case mac != nil:
+		if err := auth.HMACCheck(dotenvMACMessage(encrypted), mac); err != nil {
+			return nil, fmt.Errorf("unable to verify encrypted entries (decrypt the document to modify them): %w", err)
+		}
+	case len(encrypted) > 0:
+		// Without MAC, values cannot be told apart from plaintexts which look encrypted.
+		return nil, fmt.Errorf("unable to encrypt %s: value starts with %q, but document has no MAC", encrypted[0].key, dotenvEncryptedPrefix)
+	}
+	for i, l := range lines {
+		if !l.isEntry() || strings.HasPrefix(l.value, dotenvEncryptedPrefix) {
+			continue
+		}
+		ciphertext, err := encryptBase64(auth, []byte(l.value))
+		if err != nil {
+			return nil, fmt.Errorf("unable to encrypt %s: %w", l.key, err)
+		}
+		lines[i].value = dotenvEncryptedPrefix + string(ciphertext)
+	}
+	mac, err = auth.HMAC(dotenvMACMessage(lines))
+	if err != nil {
+		return nil, err
+	}
+	lines = append(lines, dotenvLine{text: dotenvMACPrefix + string(encodeBase64(mac))})
+	return formatDotenv(lines), nil
+}
+
+// DecryptDotenv verifies MAC of dotenv document src encrypted by EncryptDotenv, then
+// returns the document with decrypted values.
+func DecryptDotenv(auth Authenticator, src []byte) ([]byte, error) {
+	lines, err := decryptDotenv(auth, src)
+	if err != nil {
+		return nil, err
+	}
+	return formatDotenv(lines), nil
+}
+
+// ReadDotenv reads dotenv file at path encrypted by EncryptDotenv, and returns its
+// entries with values interpreted as dotenv does (unquoted, without inline comments).
+func ReadDotenv(auth Authenticator, path string) (map[string]string, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := decryptDotenv(auth, src)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt %s: %w", path, err)
+	}
+	env := map[string]string{}
+	for _, l := range lines {
+		if l.isEntry() {
+			env[l.key] = unquoteDotenv(l.value)
+		}
+	}
+	return env, nil
+}
+
+// LoadDotenv reads dotenv file at path encrypted by EncryptDotenv into environment
+// variables. Variables which are already set are not overridden.
+func LoadDotenv(auth Authenticator, path string) error {
+	env, err := ReadDotenv(auth, path)
+	if err != nil {
+		return err
+	}
+	for k, v := range env {
+		if _, ok := os.LookupEnv(k); ok {
+			continue
+		}
+		if err := os.Setenv(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncryptDotenvFile encrypts dotenv file at path in place with EncryptDotenv.
+func EncryptDotenvFile(auth Authenticator, path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	encrypted, err := EncryptDotenv(auth, src)
+	if err != nil {
+		return fmt.Errorf("unable to encrypt %s: %w", path, err)
+	}
+	return writeFileAtomic(path, encrypted)
+}
+
+// DecryptDotenvFile decrypts dotenv file at path in place with DecryptDotenv.
+func DecryptDotenvFile(auth Authenticator, path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	decrypted, err := DecryptDotenv(auth, src)
+	if err != nil {
+		return fmt.Errorf("unable to decrypt %s: %w", path, err)
+	}
+	return writeFileAtomic(path, decrypted)
+}
+
+// decryptDotenv parses src, verifies its MAC, and decrypts values of its entries.
+// The MAC comment is removed from the result.
+func decryptDotenv(auth Authenticator, src []byte) ([]dotenvLine, error) {
+	lines, err := parseDotenv(src)
+	if err != nil {
+		return nil, err
+	}
+	lines, mac, err := extractDotenvMAC(lines)
+	if err != nil {
+		return nil, err
+	}
+	if mac == nil {
+		return nil, fmt.Errorf("missing MAC: document is not encrypted by EncryptDotenv")
+	}
+	if err := auth.HMACCheck(dotenvMACMessage(lines), mac); err != nil {
+		return nil, err
+	}
+
+	for i, l := range lines {
+		if !l.isEntry() || !strings.HasPrefix(l.value, dotenvEncryptedPrefix) {
+			continue
+		}
+		plaintext, err := decryptBase64(auth, []byte(strings.TrimPrefix(l.value, dotenvEncryptedPrefix)))
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt %s: %w", l.key, err)
+		}
+		lines[i].value = string(plaintext)
+	}
+	return lines, nil
+}
+
+func parseDotenv(src []byte) ([]dotenvLine, error) {
+	var lines []dotenvLine
+	raw := strings.Split(strings.TrimSuffix(string(src), "\n"), "\n")
+	for i := 0; i < len(raw); i++ {
+		m := dotenvEntry.FindStringSubmatch(raw[i])
+		if m == nil {
+			trimmed := strings.TrimSpace(raw[i])
+			if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+				return nil, fmt.Errorf("invalid dotenv line %d: %q", i+1, raw[i])
+			}
+			lines = append(lines, dotenvLine{text: raw[i]})
+			continue
+		}
+		l := dotenvLine{prefix: m[1], key: m[2], value: m[3]}
+		// Double-quoted values may span multiple lines.
+		if v := strings.TrimSpace(l.value); strings.HasPrefix(v, `"`) {
+			start := i
+			for !closedDotenvQuote(l.value) {
+				if i++; i >= len(raw) {
+					return nil, fmt.Errorf("invalid dotenv line %d: unterminated quote", start+1)
+				}
+				l.value += "\n" + raw[i]
+			}
+		}
+		lines = append(lines, l)
+	}
+	return lines, nil
+}
+
+// extractDotenvMAC returns lines without the MAC comment, and the MAC it holds (nil if
+// there is none). Documents with multiple MAC comments (e.g. left by merges) are refused,
+// as stale ones would otherwise be kept in decrypted documents.
+func extractDotenvMAC(lines []dotenvLine) ([]dotenvLine, []byte, error) {
+	found := -1
+	for i, l := range lines {
+		if l.isEntry() || !strings.HasPrefix(l.text, dotenvMACPrefix) {
+			continue
+		}
+		if found >= 0 {
+			return nil, nil, fmt.Errorf("invalid MAC: multiple %q comments, keep only the one of the current entries", strings.TrimSpace(dotenvMACPrefix))
+		}
+		found = i
+	}
+	if found < 0 {
+		return lines, nil, nil
+	}
+	mac, err := decodeBase64([]byte(strings.TrimPrefix(lines[found].text, dotenvMACPrefix)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid MAC: %w", err)
+	}
+	return append(lines[:found], lines[found+1:]...), mac, nil
+}
+
+// closedDotenvQuote reports whether double-quoted value has its closing quote.
+func closedDotenvQuote(value string) bool {
+	v := strings.TrimSpace(value)[1:]
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '\\':
+			i++
+		case '"':
+			return true
+		}
+	}
+	return false
+}
+
+func formatDotenv(lines []dotenvLine) []byte {
+	var b bytes.Buffer
+	for _, l := range lines {
+		if l.isEntry() {
+			b.WriteString(l.prefix)
+			b.WriteString(l.value)
+		} else {
+			b.WriteString(l.text)
+		}
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// dotenvMACMessage serializes entries in order, so that their MAC changes when
+// entries are modified, reordered, or deleted.
+func dotenvMACMessage(lines []dotenvLine) []byte {
+	var b bytes.Buffer
+	for _, l := range lines {
+		if l.isEntry() {
+			writeMACEntry(&b, l.key, []byte(l.value))
+		}
+	}
+	return b.Bytes()
+}
+
+// unquoteDotenv interprets raw value: double-quoted values support escape sequences,
+// single-quoted values are literal, and unquoted values end at inline comment.
+func unquoteDotenv(value string) string {
+	v := strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(v, `"`):
+		var b strings.Builder
+		for i := 1; i < len(v); i++ {
+			switch c := v[i]; c {
+			case '"':
+				return b.String()
+			case '\\':
+				if i++; i < len(v) {
+					switch v[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 'r':
+						b.WriteByte('\r')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(v[i])
+					}
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return b.String()
+	case strings.HasPrefix(v, `'`):
+		if end := strings.Index(v[1:], `'`); end >= 0 {
+			return v[1 : end+1]
+		}
+		return v[1:]
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = v[:i]
+	}
+	return strings.TrimSpace(v)
+}
@@ -0,0 +1,149 @@
+package secret
+
+import (
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Encoding is text encoding of ciphertexts produced by MarshalText.
+// The zero value defers to the authenticator (see WithEncoding), otherwise EncodingBase64URL.
+type Encoding int
+
+const (
+	// EncodingBase64URL is unpadded URL-safe Base64 (base64.RawURLEncoding), which is the default.
+	EncodingBase64URL Encoding = iota + 1
+	// EncodingBase64 is padded standard Base64 (base64.StdEncoding).
+	EncodingBase64
+	// EncodingHex is lowercase hexadecimal.
+	EncodingHex
+	// EncodingBase32Crockford is unpadded Crockford's Base32, which is case-insensitive
+	// and safe in URLs and file names.
+	EncodingBase32Crockford
+)
+
+// encodings are attempted in order when decoding text of unknown encoding.
+var encodings = []Encoding{EncodingBase64URL, EncodingBase64, EncodingHex, EncodingBase32Crockford}
+
+var crockfordEncoding = base32.NewEncoding("0123456789ABCDEFGHJKMNPQRSTVWXYZ").WithPadding(base32.NoPadding)
+
+// crockfordNormalizer maps characters which Crockford's Base32 decodes leniently.
+var crockfordNormalizer = strings.NewReplacer("O", "0", "I", "1", "L", "1", "-", "")
+
+// EncodingAuthenticator is implemented by authenticators configured with text
+// encoding of ciphertexts (see WithEncoding).
+type EncodingAuthenticator interface {
+	Authenticator
+	Encoding() Encoding
+}
+
+var _ EncodingAuthenticator = (*AESGCM)(nil)
+
+// WithEncoding configures text encoding of ciphertexts produced by MarshalText of
+// values encrypted by the authenticator, unless configured per value.
+func WithEncoding(e Encoding) Option {
+	return func(a *AESGCM) error {
+		if e != 0 && !e.valid() {
+			return fmt.Errorf("unknown encoding: %d", e)
+		}
+		a.encoding = e
+		return nil
+	}
+}
+
+// Encoding returns text encoding configured by WithEncoding.
+func (a *AESGCM) Encoding() Encoding {
+	return a.encoding
+}
+
+func (e Encoding) valid() bool {
+	return e >= EncodingBase64URL && e <= EncodingBase32Crockford
+}
+
+func (e Encoding) String() string {
+	switch e {
+	case EncodingBase64URL:
+		return "base64url"
+	case EncodingBase64:
+		return "base64"
+	case EncodingHex:
+		return "hex"
+	case EncodingBase32Crockford:
+		return "base32-crockford"
+	}
+	return fmt.Sprintf("Encoding(%d)", int(e))
+}
+
+// Encode returns data encoded as text.
+func (e Encoding) Encode(data []byte) []byte {
+	return e.AppendEncode(nil, data)
+}
+
+// Decode returns data decoded from text.
+func (e Encoding) Decode(text []byte) ([]byte, error) {
+	return e.AppendDecode(nil, text)
+}
+
+// WithEncoding returns a copy of s which is marshaled as text with encoding e,
+// regardless of encoding configured on its authenticator.
+func (s Bytes) WithEncoding(e Encoding) Bytes {
+	s.encoding = e
+	return s
+}
+
+// WithEncoding returns a copy of s which is marshaled as text with encoding e,
+// regardless of encoding configured on its authenticator.
+func (s String) WithEncoding(e Encoding) String {
+	return String{Bytes: s.Bytes.WithEncoding(e)}
+}
+
+// textEncoding returns encoding of s when encrypted by auth, which is zero if
+// neither is configured.
+func (s Bytes) textEncoding(auth Authenticator) Encoding {
+	if s.encoding != 0 {
+		return s.encoding
+	}
+	if ea, ok := auth.(EncodingAuthenticator); ok {
+		return ea.Encoding()
+	}
+	return 0
+}
+
+// decodeText decodes text with preferred encoding, then other encodings, passing the
+// result to open until it succeeds, as text may be encoded differently than configured
+// (e.g. during migration between encodings). This relies on open to authenticate data,
+// so that data decoded with the wrong encoding is refused.
+func decodeText(text []byte, preferred Encoding, open func(data []byte) error) error {
+	if !preferred.valid() {
+		preferred = EncodingBase64URL
+	}
+	order := []Encoding{preferred}
+	for _, e := range encodings {
+		if e != preferred {
+			order = append(order, e)
+		}
+	}
+
+	var decodeErr, openErr error
+	for _, e := range order {
+		data, err := e.Decode(text)
+		if err != nil {
+			if decodeErr == nil {
+				decodeErr = err
+			}
+			continue
+		}
+		err = open(data)
+		if err == nil || errors.Is(err, ErrExpired) {
+			return err
+		}
+		if openErr == nil {
+			openErr = err
+		}
+	}
+	if openErr != nil {
+		return openErr
+	}
+	return decodeErr
+}
@@ -0,0 +1,140 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodingRoundTrip(t *testing.T) {
+	data := []byte("poyo\x00\xff kirby")
+	for _, e := range encodings {
+		text := e.Encode(data)
+		decoded, err := e.Decode(text)
+		if err != nil {
+			t.Fatalf("%s: %v", e, err)
+		}
+		if !bytes.Equal(data, decoded) {
+			t.Fatalf("%s: unequal:\n\tsrc: %x\n\tdst: %x\n", e, data, decoded)
+		}
+	}
+
+	// Crockford's Base32 is case-insensitive, and tolerates ambiguous characters and hyphens.
+	text := string(EncodingBase32Crockford.Encode([]byte{0x00, 0x40}))
+	if text != "0100" {
+		t.Fatalf("unexpected crockford encoding: %s", text)
+	}
+	for _, lenient := range []string{"oIoO", "0-l-0-0"} {
+		decoded, err := EncodingBase32Crockford.Decode([]byte(lenient))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(decoded) != "0040" {
+			t.Fatalf("%s: unexpected decoding: %x", lenient, decoded)
+		}
+	}
+}
+
+func TestEncodingMarshalText(t *testing.T) {
+	auth := getAuth()
+	for e, pattern := range map[Encoding]string{
+		EncodingBase64URL:       `^[A-Za-z0-9_-]+$`,
+		EncodingBase64:          `^[A-Za-z0-9+/]+=*$`,
+		EncodingHex:             `^[0-9a-f]+$`,
+		EncodingBase32Crockford: `^[0-9A-HJKMNP-TV-Z]+$`,
+	} {
+		src := NewStringWithAuth(auth, "a full commitment's what i'm thinking of").WithEncoding(e)
+		text, err := src.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(pattern).Match(text) {
+			t.Fatalf("%s: unexpected text: %s", e, text)
+		}
+
+		// Decoding recognizes every encoding, regardless of the configured one.
+		for _, configured := range encodings {
+			dst := NewStringWithAuth(auth, "").WithEncoding(configured)
+			if err := dst.UnmarshalText(text); err != nil {
+				t.Fatalf("%s decoded as %s: %v", e, configured, err)
+			}
+			if src.Value() != dst.Value() {
+				t.Fatalf("unequal:\n\tsrc: %s\n\tdst: %s\n", src.Value(), dst.Value())
+			}
+		}
+	}
+}
+
+func TestEncodingAuthenticator(t *testing.T) {
+	key, err := KeyFromString(testStringKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := NewAuthenticatorAESGCM(key, WithEncoding(EncodingHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewAuthenticatorAESGCM(key, WithEncoding(Encoding(42))); err == nil {
+		t.Fatal("unknown encoding was unexpectedly accepted")
+	}
+
+	src := NewStringWithAuth(auth, "you know the rules and so do i").WithTTL(time.Hour)
+	text, err := src.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hex.DecodeString(string(text)); err != nil {
+		t.Fatalf("text is not hex-encoded: %s", text)
+	}
+	// Value encoding takes precedence over authenticator encoding.
+	text, err = src.WithEncoding(EncodingBase64).MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base64.StdEncoding.DecodeString(string(text)); err != nil {
+		t.Fatalf("text is not standard Base64: %s", text)
+	}
+	if _, err := hex.DecodeString(string(text)); err == nil {
+		t.Fatalf("text is unexpectedly hex-encoded: %s", text)
+	}
+
+	dst := NewStringWithAuth(auth, "")
+	if err := dst.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if src.Value() != dst.Value() || dst.ExpiresAt().IsZero() {
+		t.Fatalf("unequal:\n\tsrc: %s\n\tdst: %s (expires at %s)\n", src.Value(), dst.Value(), dst.ExpiresAt())
+	}
+}
+
+func TestEncodingUnmarshalTextErrors(t *testing.T) {
+	auth := getAuth()
+	dst := NewStringWithAuth(auth, "")
+	if err := dst.UnmarshalText([]byte("!!!")); err == nil {
+		t.Fatal("invalid text was unexpectedly accepted")
+	}
+
+	// Expiry is reported as is, rather than attempting other encodings.
+	SetClock(func() time.Time { return time.Unix(1_000_000, 0) })
+	defer SetClock(nil)
+	text, err := NewStringWithAuth(auth, "poyo").WithTTL(time.Minute).WithEncoding(EncodingHex).MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetClock(func() time.Time { return time.Unix(1_000_000, 0).Add(time.Hour) })
+	if err := dst.UnmarshalText(text); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expecting ErrExpired, but received %v", err)
+	}
+
+	// Authenticators with their own text representation report their own errors.
+	f := getFernet(t, "1985-10-26T01:20:01-07:00")
+	dst = NewStringWithAuth(f, "")
+	if err := dst.UnmarshalText([]byte(strings.Repeat("A", 100))); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expecting ErrInvalidToken, but received %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package secret
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrExpired is returned when decrypting a value past its expiry.
+	// Errors of expired tokens (e.g. ErrTokenExpired) also match ErrExpired with errors.Is.
+	ErrExpired = errors.New("expired")
+)
+
+var clock = time.Now
+
+// SetClock overrides the source of current time, used to issue and enforce expiry
+// of ciphertexts and tokens, e.g. to keep tests deterministic. Passing nil restores time.Now.
+func SetClock(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	clock = now
+}
+
+// now returns current time from clock configured by SetClock.
+func now() time.Time {
+	return clock()
+}
+
+const (
+	// aesGCMExpiringVersion prefixes AES-GCM ciphertexts which embed issued-at and
+	// expires-at timestamps, authenticated as additional data.
+	aesGCMExpiringVersion = 0xe1
+	// version + issued-at + expires-at
+	aesGCMExpiringHeaderLength = 1 + 8 + 8
+)
+
+// ExpiringAuthenticator is implemented by authenticators which are able to embed
+// authenticated expiry in ciphertexts, which are refused by Decrypt with ErrExpired
+// once expired.
+type ExpiringAuthenticator interface {
+	Authenticator
+	// EncryptWithExpiry is similar to Encrypt, except the ciphertext expires at expiresAt.
+	EncryptWithExpiry(secret []byte, expiresAt time.Time) ([]byte, error)
+	// DecryptWithExpiry is similar to Decrypt, except it also returns expiry of the
+	// ciphertext, which is zero if the ciphertext does not expire.
+	DecryptWithExpiry(ciphertext []byte) ([]byte, time.Time, error)
+}
+
+var _ ExpiringAuthenticator = (*AESGCM)(nil)
+
+// EncryptWithExpiry is similar to Encrypt, except the ciphertext embeds time of
+// issuance and expiresAt, after which Decrypt refuses it with ErrExpired.
+func (a *AESGCM) EncryptWithExpiry(secret []byte, expiresAt time.Time) ([]byte, error) {
+	header := make([]byte, aesGCMExpiringHeaderLength, aesGCMExpiringHeaderLength+aesGCMNonceLength+len(secret)+aesGCMTagLength)
+	header[0] = aesGCMExpiringVersion
+	binary.BigEndian.PutUint64(header[1:9], uint64(now().Unix()))
+	binary.BigEndian.PutUint64(header[9:17], uint64(expiresAt.Unix()))
+
+	// Ciphertext is appended right after the header, which is authenticated as additional data.
+	return a.encryptAppend(header, secret, header)
+}
+
+// DecryptWithExpiry is similar to Decrypt, except it also returns expiry of the
+// ciphertext, which is zero if the ciphertext does not expire.
+func (a *AESGCM) DecryptWithExpiry(data []byte) ([]byte, time.Time, error) {
+	return a.decryptWithExpiryAppend(nil, data)
+}
+
+func (a *AESGCM) decryptWithExpiryAppend(dst, data []byte) ([]byte, time.Time, error) {
+	if len(data) >= aesGCMExpiringHeaderLength+aesGCMNonceLength+aesGCMTagLength && data[0] == aesGCMExpiringVersion {
+		header := data[:aesGCMExpiringHeaderLength]
+		// Nonce of ciphertexts without expiry may coincidentally start with the version,
+		// in which case authentication fails and the ciphertext is attempted as such.
+		if secret, err := a.decryptAppend(dst, data[aesGCMExpiringHeaderLength:], header); err == nil {
+			expiresAt := time.Unix(int64(binary.BigEndian.Uint64(header[9:17])), 0)
+			if !now().Before(expiresAt) {
+				return nil, expiresAt, fmt.Errorf("%w at %s", ErrExpired, expiresAt.UTC().Format(time.RFC3339))
+			}
+			return secret, expiresAt, nil
+		}
+	}
+	secret, err := a.decryptAppend(dst, data, nil)
+	return secret, time.Time{}, err
+}
+
+// WithExpiry returns a copy of s which, when marshaled, expires at expiresAt.
+// Authenticator must implement ExpiringAuthenticator.
+func (s Bytes) WithExpiry(expiresAt time.Time) Bytes {
+	s.expiresAt = expiresAt
+	s.ttl = 0
+	return s
+}
+
+// WithTTL returns a copy of s which, when marshaled, expires after ttl since the time
+// of marshaling. Authenticator must implement ExpiringAuthenticator.
+func (s Bytes) WithTTL(ttl time.Duration) Bytes {
+	s.expiresAt = time.Time{}
+	s.ttl = ttl
+	return s
+}
+
+// ExpiresAt returns expiry of s, which is zero if s does not expire.
+// Unmarshaled values retain expiry of their ciphertexts, so that it is preserved when
+// marshaled again.
+func (s Bytes) ExpiresAt() time.Time {
+	if s.ttl > 0 {
+		return now().Add(s.ttl)
+	}
+	return s.expiresAt
+}
+
+// WithExpiry returns a copy of s which, when marshaled, expires at expiresAt.
+// Authenticator must implement ExpiringAuthenticator.
+func (s String) WithExpiry(expiresAt time.Time) String {
+	return String{Bytes: s.Bytes.WithExpiry(expiresAt)}
+}
+
+// WithTTL returns a copy of s which, when marshaled, expires after ttl since the time
+// of marshaling. Authenticator must implement ExpiringAuthenticator.
+func (s String) WithTTL(ttl time.Duration) String {
+	return String{Bytes: s.Bytes.WithTTL(ttl)}
+}
+
+// encrypt encrypts secret of s with auth, embedding expiry if configured.
+func (s Bytes) encrypt(auth Authenticator) ([]byte, error) {
+	expiresAt := s.ExpiresAt()
+	if expiresAt.IsZero() {
+		return auth.Encrypt(s.secret)
+	}
+	ea, ok := auth.(ExpiringAuthenticator)
+	if !ok {
+		return nil, fmt.Errorf("authenticator %T does not support expiry", auth)
+	}
+	return ea.EncryptWithExpiry(s.secret, expiresAt)
+}
+
+// decrypt decrypts ciphertext with auth into s, retaining its expiry if available.
+func (s *Bytes) decrypt(auth Authenticator, ciphertext []byte) error {
+	if ea, ok := auth.(ExpiringAuthenticator); ok {
+		secret, expiresAt, err := ea.DecryptWithExpiry(ciphertext)
+		if err != nil {
+			return err
+		}
+		s.secret, s.expiresAt, s.ttl = secret, expiresAt, 0
+		return nil
+	}
+	secret, err := auth.Decrypt(ciphertext)
+	if err != nil {
+		return err
+	}
+	s.secret = secret
+	return nil
+}
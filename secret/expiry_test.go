@@ -0,0 +1,88 @@
+package secret
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStringWithTTL(t *testing.T) {
+	current := time.Date(2022, 2, 22, 0, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return current })
+	defer SetClock(nil)
+
+	auth := getAuth()
+	src := NewStringWithAuth(auth, "one-time-download-token").WithTTL(time.Hour)
+	raw, err := json.Marshal(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("ciphertext (json string): %s", raw)
+
+	current = current.Add(59 * time.Minute)
+	dst := NewStringWithAuth(auth, "")
+	if err := json.Unmarshal(raw, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if src.Value() != dst.Value() {
+		t.Fatalf("unequal:\n\tsrc: %s\n\tdst: %s\n", src.Value(), dst.Value())
+	}
+	if expected := time.Date(2022, 2, 22, 1, 0, 0, 0, time.UTC); !dst.ExpiresAt().Equal(expected) {
+		t.Fatalf("expiry was not retained: expected %s, received %s", expected, dst.ExpiresAt())
+	}
+
+	// Expiry should be preserved when marshaled again.
+	raw, err = json.Marshal(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current = current.Add(time.Minute)
+	if err := json.Unmarshal(raw, &dst); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expecting ErrExpired, received %v", err)
+	}
+}
+
+func TestDecryptWithoutExpiry(t *testing.T) {
+	auth := getAuth()
+	for i := 0; i < 512; i++ {
+		ciphertext, err := auth.Encrypt([]byte(`carby is best kirby`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		secret, expiresAt, err := auth.DecryptWithExpiry(ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(secret) != `carby is best kirby` || !expiresAt.IsZero() {
+			t.Fatalf("unexpected secret %q with expiry %s", secret, expiresAt)
+		}
+	}
+}
+
+func TestExpiryUnsupported(t *testing.T) {
+	src := NewStringWithAuth(reverseAuth{}, "kirby").WithExpiry(time.Now().Add(time.Hour))
+	if _, err := src.MarshalText(); err == nil {
+		t.Fatal("marshaling with expiry unexpectedly succeeded")
+	}
+}
+
+func TestInspectExpiring(t *testing.T) {
+	current := time.Date(2022, 2, 22, 0, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return current })
+	defer SetClock(nil)
+
+	ciphertext, err := NewStringWithAuth(getAuth(), "kirby").WithTTL(time.Hour).MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := Inspect(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("inspection:\n%s", i)
+	if !i.CreatedAt.Equal(current) || !i.ExpiresAt.Equal(current.Add(time.Hour)) || i.CiphertextSize != 5 {
+		t.Fatalf("unexpected inspection: %+v", i)
+	}
+}
@@ -0,0 +1,262 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = fmt.Errorf("token %w", ErrExpired)
+)
+
+const (
+	FernetKeyLength = 32 // Fernet keys are 128-bit signing key followed by 128-bit encryption key
+
+	fernetVersion = 0x80
+	// Tokens issued further than this in the future are rejected when TTL is enforced,
+	// following the reference implementation.
+	fernetMaxClockSkew = 60 * time.Second
+
+	fernetHeaderLength = 1 + 8 + aes.BlockSize // version + timestamp + IV
+	fernetMinLength    = fernetHeaderLength + aes.BlockSize + sha256.Size
+)
+
+var _ Base64Authenticator = (*Fernet)(nil)
+
+// Fernet is an Authenticator which produces tokens following the Fernet spec
+// (https://github.com/fernet/spec), interoperable with other implementations
+// such as the Python "cryptography" package.
+//
+// Multiple keys are supported for rotation (similar to MultiFernet): the first
+// key is used to encrypt, while all keys are attempted to decrypt.
+type Fernet struct {
+	// TTL, if non-zero, causes Decrypt to reject tokens issued longer than TTL ago
+	// with ErrTokenExpired.
+	TTL time.Duration
+
+	keys []fernetKey
+	now  func() time.Time
+}
+
+type fernetKey struct {
+	signing    []byte
+	encryption cipher.Block
+	// hmac is derived from signing, so that HMAC never signs Fernet-shaped tokens.
+	hmac []byte
+}
+
+// NewAuthenticatorFernet creates Fernet authenticator from one or more 32-byte keys.
+// Use DecodeFernetKey for keys in the textual (URL-safe base64) representation.
+func NewAuthenticatorFernet(keys ...[]byte) (*Fernet, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("fernet requires at least one key")
+	}
+	f := &Fernet{now: now}
+	for i, key := range keys {
+		if len(key) != FernetKeyLength {
+			return nil, fmt.Errorf("fernet key #%d: expected %d bytes, actual %d", i, FernetKeyLength, len(key))
+		}
+		block, err := aes.NewCipher(key[16:])
+		if err != nil {
+			return nil, err
+		}
+		f.keys = append(f.keys, fernetKey{
+			signing:    key[:16],
+			encryption: block,
+			hmac:       hkdf(sha256.New, key[:16], nil, []byte("secret-fernet-hmac"), sha256.Size),
+		})
+	}
+	return f, nil
+}
+
+// NewFernetKey generates a random key in the textual representation of Fernet keys.
+func NewFernetKey() (string, error) {
+	key, err := NewKey(FernetKeyLength)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(key), nil
+}
+
+// DecodeFernetKey decodes key from its textual (URL-safe base64) representation.
+func DecodeFernetKey(str string) ([]byte, error) {
+	return base64.URLEncoding.DecodeString(str)
+}
+
+// Encrypt takes in secret and outputs binary representation of Fernet token.
+func (f *Fernet) Encrypt(secret []byte) ([]byte, error) {
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	return f.keys[0].seal(secret, f.now(), iv), nil
+}
+
+// EncryptBase64 takes in secret and outputs Fernet token.
+func (f *Fernet) EncryptBase64(secret []byte) ([]byte, error) {
+	token, err := f.Encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+	return encodeFernet(token), nil
+}
+
+// Decrypt takes in binary representation of Fernet token and outputs secret.
+func (f *Fernet) Decrypt(token []byte) ([]byte, error) {
+	secret, _, err := f.open(token, f.TTL)
+	return secret, err
+}
+
+// DecryptBase64 takes in Fernet token and outputs secret.
+func (f *Fernet) DecryptBase64(token []byte) ([]byte, error) {
+	data, err := decodeFernet(token)
+	if err != nil {
+		return nil, err
+	}
+	return f.Decrypt(data)
+}
+
+// Rotate re-encrypts Fernet token with the first key, preserving its timestamp.
+// TTL is not enforced, so that expired tokens remain expired after rotation.
+func (f *Fernet) Rotate(token []byte) ([]byte, error) {
+	data, err := decodeFernet(token)
+	if err != nil {
+		return nil, err
+	}
+	secret, issuedAt, err := f.open(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	return encodeFernet(f.keys[0].seal(secret, issuedAt, iv)), nil
+}
+
+// HMAC creates a message authentication code (MAC) for a given message with
+// nonce prefix, using a key derived from signing key of the first key.
+func (f *Fernet) HMAC(msg []byte) ([]byte, error) {
+	nonce := make([]byte, hmacNonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return calcNonceHMAC(f.keys[0].hmac, nonce, msg), nil
+}
+
+// HMACCheck validates if a message and its MAC is consistent with any of the keys.
+func (f *Fernet) HMACCheck(msg, expected []byte) error {
+	if len(expected) < hmacNonceLength {
+		return ErrHMACMismatch
+	}
+	for _, k := range f.keys {
+		if hmac.Equal(calcNonceHMAC(k.hmac, expected[:hmacNonceLength], msg), expected) {
+			return nil
+		}
+	}
+	return ErrHMACMismatch
+}
+
+// IssuedAt returns the timestamp embedded in Fernet token, without verifying it.
+func (f *Fernet) IssuedAt(token []byte) (time.Time, error) {
+	data, err := decodeFernet(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(data) < fernetMinLength || data[0] != fernetVersion {
+		return time.Time{}, ErrInvalidToken
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(data[1:9])), 0), nil
+}
+
+func (f *Fernet) open(data []byte, ttl time.Duration) ([]byte, time.Time, error) {
+	if len(data) < fernetMinLength || data[0] != fernetVersion {
+		return nil, time.Time{}, ErrInvalidToken
+	}
+	issuedAt := time.Unix(int64(binary.BigEndian.Uint64(data[1:9])), 0)
+	if ttl > 0 {
+		now := f.now()
+		if issuedAt.Add(ttl).Before(now) {
+			return nil, time.Time{}, ErrTokenExpired
+		}
+		if issuedAt.After(now.Add(fernetMaxClockSkew)) {
+			return nil, time.Time{}, fmt.Errorf("%w: timestamp is too far in the future", ErrInvalidToken)
+		}
+	}
+	for _, k := range f.keys {
+		if secret, err := k.open(data); err == nil {
+			return secret, issuedAt, nil
+		}
+	}
+	return nil, time.Time{}, ErrInvalidToken
+}
+
+func (k fernetKey) seal(secret []byte, issuedAt time.Time, iv []byte) []byte {
+	padding := aes.BlockSize - len(secret)%aes.BlockSize
+	plaintext := make([]byte, len(secret)+padding)
+	copy(plaintext, secret)
+	copy(plaintext[len(secret):], bytes.Repeat([]byte{byte(padding)}, padding))
+
+	token := make([]byte, fernetHeaderLength, fernetHeaderLength+len(plaintext)+sha256.Size)
+	token[0] = fernetVersion
+	binary.BigEndian.PutUint64(token[1:9], uint64(issuedAt.Unix()))
+	copy(token[9:fernetHeaderLength], iv)
+	token = token[:fernetHeaderLength+len(plaintext)]
+	cipher.NewCBCEncrypter(k.encryption, iv).CryptBlocks(token[fernetHeaderLength:], plaintext)
+
+	mac := hmac.New(sha256.New, k.signing)
+	mac.Write(token)
+	return mac.Sum(token)
+}
+
+func (k fernetKey) open(data []byte) ([]byte, error) {
+	signed, sum := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	mac := hmac.New(sha256.New, k.signing)
+	mac.Write(signed)
+	if !hmac.Equal(mac.Sum(nil), sum) {
+		return nil, ErrInvalidToken
+	}
+
+	iv, ciphertext := signed[9:fernetHeaderLength], signed[fernetHeaderLength:]
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, ErrInvalidToken
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(k.encryption, iv).CryptBlocks(plaintext, ciphertext)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, ErrInvalidToken
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, ErrInvalidToken
+		}
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+func encodeFernet(token []byte) []byte {
+	b64 := make([]byte, base64.URLEncoding.EncodedLen(len(token)))
+	base64.URLEncoding.Encode(b64, token)
+	return b64
+}
+
+func decodeFernet(b64 []byte) ([]byte, error) {
+	data := make([]byte, base64.URLEncoding.DecodedLen(len(b64)))
+	n, err := base64.URLEncoding.Decode(data, b64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return data[:n], nil
+}
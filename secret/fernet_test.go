@@ -0,0 +1,173 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Published test vectors from https://github.com/fernet/spec (generate.json, verify.json).
+const (
+	fernetVectorSecret = "cw_0x689RpI-jtRR7oE8h_eQsKImvJapLeSbXpwF4e4="
+	fernetVectorToken  = "gAAAAAAdwJ6wAAECAwQFBgcICQoLDA0ODy021cpGVWKZ_eEwCGM4BLLF_5CV9dOPmrhuVUPgJobwOz7JcbmrR64jVmpU4IwqDA=="
+	fernetVectorSource = "hello"
+)
+
+func getFernet(t *testing.T, now string) *Fernet {
+	t.Helper()
+	key, err := DecodeFernetKey(fernetVectorSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewAuthenticatorFernet(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := time.Parse(time.RFC3339, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.now = func() time.Time { return ts }
+	return f
+}
+
+func TestFernetGenerateVector(t *testing.T) {
+	f := getFernet(t, "1985-10-26T01:20:00-07:00")
+	iv := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+	token := encodeFernet(f.keys[0].seal([]byte(fernetVectorSource), f.now(), iv))
+	if string(token) != fernetVectorToken {
+		t.Fatalf("expected:\n\t%s\nreceived:\n\t%s", fernetVectorToken, token)
+	}
+}
+
+func TestFernetVerifyVector(t *testing.T) {
+	f := getFernet(t, "1985-10-26T01:20:01-07:00")
+	f.TTL = 60 * time.Second
+
+	secret, err := f.DecryptBase64([]byte(fernetVectorToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != fernetVectorSource {
+		t.Fatalf("expected %q, received %q", fernetVectorSource, secret)
+	}
+}
+
+func TestFernetInvalid(t *testing.T) {
+	raw, err := base64.URLEncoding.DecodeString(fernetVectorToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamper := func(i int) string {
+		data := append([]byte(nil), raw...)
+		data[i] ^= 0x01
+		return base64.URLEncoding.EncodeToString(data)
+	}
+
+	cases := []struct {
+		desc, token, now string
+		expected         error
+	}{
+		{"incorrect mac", tamper(len(raw) - 1), "1985-10-26T01:20:01-07:00", ErrInvalidToken},
+		{"incorrect iv", tamper(9), "1985-10-26T01:20:01-07:00", ErrInvalidToken},
+		{"incorrect version", tamper(0), "1985-10-26T01:20:01-07:00", ErrInvalidToken},
+		{"too short", base64.URLEncoding.EncodeToString(raw[:fernetMinLength-1]), "1985-10-26T01:20:01-07:00", ErrInvalidToken},
+		{"invalid base64", "%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%", "1985-10-26T01:20:01-07:00", ErrInvalidToken},
+		{"expired ttl", fernetVectorToken, "1985-10-26T01:21:31-07:00", ErrTokenExpired},
+		{"far-future timestamp", fernetVectorToken, "1985-10-26T01:18:00-07:00", ErrInvalidToken},
+	}
+	for _, c := range cases {
+		f := getFernet(t, c.now)
+		f.TTL = 60 * time.Second
+		if _, err := f.DecryptBase64([]byte(c.token)); !errors.Is(err, c.expected) {
+			t.Errorf("%s: expecting %v, received %v", c.desc, c.expected, err)
+		}
+	}
+}
+
+func TestFernetRotation(t *testing.T) {
+	oldKey, err := NewKey(FernetKeyLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := NewKey(FernetKeyLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := NewAuthenticatorFernet(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewAuthenticatorFernet(newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := NewAuthenticatorFernet(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := NewStringWithAuth(old, "one ring to rule them all")
+	token, err := src.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := current.DecryptBase64(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expecting ErrInvalidToken, received %v", err)
+	}
+
+	dst := NewStringWithAuth(rotated, "")
+	if err := dst.UnmarshalText(token); err != nil {
+		t.Fatal(err)
+	}
+	if src.Value() != dst.Value() {
+		t.Fatalf("unequal:\n\tsrc: %s\n\tdst: %s\n", src.Value(), dst.Value())
+	}
+
+	token, err = rotated.Rotate(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := current.DecryptBase64(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != src.Value() {
+		t.Fatalf("unequal:\n\tsrc: %s\n\tdst: %s\n", src.Value(), secret)
+	}
+}
+
+func TestFernetHMAC(t *testing.T) {
+	oldKey, err := NewKey(FernetKeyLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := NewAuthenticatorFernet(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := NewKey(FernetKeyLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewAuthenticatorFernet(newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []byte("one ring to rule them all")
+	mac, err := old.HMAC(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rotated.HMACCheck(msg, mac); err != nil {
+		t.Fatal(err)
+	}
+	// MACs must not be made with the key which signs Fernet tokens.
+	if bytes.Equal(mac, calcNonceHMAC(oldKey[:16], mac[:hmacNonceLength], msg)) {
+		t.Fatal("HMAC used signing key of Fernet tokens")
+	}
+}
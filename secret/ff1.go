@@ -0,0 +1,236 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"unicode/utf8"
+)
+
+// Format-preserving encryption keeps length and alphabet of secrets, e.g. encrypting
+// a 16-digit card number results in another 16-digit number, so that ciphertexts fit
+// into systems which validate format. FF1 (NIST SP 800-38G) is deterministic, therefore
+// ciphertexts reveal which secrets are equal (see AESSIV), unless tweaks differ.
+
+var (
+	ErrInvalidFF1Input = errors.New("invalid ff1 input")
+)
+
+// Alphabets for NewFF1.
+const (
+	FF1Digits       = "0123456789"
+	FF1Alphanumeric = "0123456789abcdefghijklmnopqrstuvwxyz"
+)
+
+const (
+	ff1Rounds   = 10
+	ff1MaxRadix = 1 << 16
+	// Domain of secrets must have at least a million values, per SP 800-38G Rev. 1.
+	ff1MinDomain = 1_000_000
+)
+
+// FF1 encrypts strings of an alphabet with FF1 (NIST SP 800-38G), whose ciphertexts
+// have the same length and alphabet.
+type FF1 struct {
+	block    cipher.Block
+	alphabet []rune
+	index    map[rune]int
+	radix    *big.Int
+}
+
+// NewFF1 returns FF1 for strings of alphabet (e.g. FF1Digits), whose radix is the
+// number of its characters, between 2 and 65536. key is an AES key, which is either
+// 16, 24, or 32 bytes.
+func NewFF1(key []byte, alphabet string) (*FF1, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	f := &FF1{
+		block:    block,
+		alphabet: []rune(alphabet),
+		index:    map[rune]int{},
+	}
+	if len(f.alphabet) < 2 || len(f.alphabet) > ff1MaxRadix {
+		return nil, fmt.Errorf("ff1 alphabet must have between 2 and %d characters, received %d", ff1MaxRadix, len(f.alphabet))
+	}
+	for i, r := range f.alphabet {
+		if r == utf8.RuneError {
+			return nil, fmt.Errorf("ff1 alphabet must be valid utf-8")
+		}
+		if _, ok := f.index[r]; ok {
+			return nil, fmt.Errorf("ff1 alphabet has duplicate character %q", r)
+		}
+		f.index[r] = i
+	}
+	f.radix = big.NewInt(int64(len(f.alphabet)))
+	return f, nil
+}
+
+// Radix returns the number of characters of the alphabet.
+func (f *FF1) Radix() int {
+	return len(f.alphabet)
+}
+
+// Encrypt returns ciphertext of plaintext, which must only consist of characters of the
+// alphabet, and be long enough to have a million possible values (e.g. 6 digits).
+// The same tweak (which may be empty) must be provided to Decrypt, and varying it
+// (e.g. by column or tenant) results in unrelated ciphertexts of the same plaintext.
+func (f *FF1) Encrypt(plaintext string, tweak []byte) (string, error) {
+	x, err := f.numerals(plaintext)
+	if err != nil {
+		return "", err
+	}
+	return f.string(f.cipher(x, tweak, true)), nil
+}
+
+// Decrypt returns plaintext of ciphertext encrypted by Encrypt with the same tweak.
+func (f *FF1) Decrypt(ciphertext string, tweak []byte) (string, error) {
+	x, err := f.numerals(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return f.string(f.cipher(x, tweak, false)), nil
+}
+
+// cipher implements FF1.Encrypt and FF1.Decrypt of SP 800-38G Section 5.1.
+func (f *FF1) cipher(x []int, tweak []byte, encrypt bool) []int {
+	n := len(x)
+	u := n / 2
+	v := n - u
+	a, b := x[:u], x[u:]
+
+	radixU := new(big.Int).Exp(f.radix, big.NewInt(int64(u)), nil)
+	radixV := new(big.Int).Exp(f.radix, big.NewInt(int64(v)), nil)
+	byteLen := (new(big.Int).Sub(radixV, big.NewInt(1)).BitLen() + 7) / 8
+	d := 4*((byteLen+3)/4) + 4
+
+	p := make([]byte, aes.BlockSize, aes.BlockSize+len(tweak)+aes.BlockSize+byteLen)
+	p[0], p[1], p[2] = 1, 2, 1
+	radix := uint32(len(f.alphabet))
+	p[3], p[4], p[5] = byte(radix>>16), byte(radix>>8), byte(radix)
+	p[6], p[7] = 10, byte(u)
+	binary.BigEndian.PutUint32(p[8:12], uint32(n))
+	binary.BigEndian.PutUint32(p[12:16], uint32(len(tweak)))
+
+	pq := append(p, tweak...)
+	pad := (-len(tweak) - byteLen - 1) % aes.BlockSize
+	if pad < 0 {
+		pad += aes.BlockSize
+	}
+	pq = append(pq, make([]byte, pad)...)
+	roundIndex := len(pq)
+	pq = append(pq, 0)
+	numIndex := len(pq)
+	pq = append(pq, make([]byte, byteLen)...)
+
+	s := make([]byte, ((d+aes.BlockSize-1)/aes.BlockSize)*aes.BlockSize)
+	numA, numB, y, c := new(big.Int), new(big.Int), new(big.Int), new(big.Int)
+	for round := 0; round < ff1Rounds; round++ {
+		i := round
+		if !encrypt {
+			i = ff1Rounds - 1 - round
+		}
+		// B is the input of PRF while encrypting, or A while decrypting.
+		if encrypt {
+			f.num(numB, b)
+		} else {
+			f.num(numB, a)
+		}
+		pq[roundIndex] = byte(i)
+		numB.FillBytes(pq[numIndex:])
+
+		f.prf(s, pq, d)
+		y.SetBytes(s[:d])
+
+		m, modulo := u, radixU
+		if i%2 == 1 {
+			m, modulo = v, radixV
+		}
+		if encrypt {
+			f.num(numA, a)
+			c.Add(numA, y)
+		} else {
+			f.num(numA, b)
+			c.Sub(numA, y)
+		}
+		c.Mod(c, modulo)
+		next := f.str(c, m)
+		if encrypt {
+			a, b = b, next
+		} else {
+			a, b = next, a
+		}
+	}
+	return append(append(make([]int, 0, n), a...), b...)
+}
+
+// prf computes R by CBC-MAC of pq and extends it to s, as steps 6.ii and 6.iii.
+func (f *FF1) prf(s, pq []byte, d int) {
+	r := s[:aes.BlockSize]
+	for i := range r {
+		r[i] = 0
+	}
+	for i := 0; i < len(pq); i += aes.BlockSize {
+		xorBytes(r, r, pq[i:i+aes.BlockSize])
+		f.block.Encrypt(r, r)
+	}
+	for j := 1; j*aes.BlockSize < d; j++ {
+		block := s[j*aes.BlockSize : (j+1)*aes.BlockSize]
+		copy(block, r)
+		var counter [aes.BlockSize]byte
+		binary.BigEndian.PutUint64(counter[8:], uint64(j))
+		xorBytes(block, block, counter[:])
+		f.block.Encrypt(block, block)
+	}
+}
+
+// num sets z to the number represented by numerals x, most significant first.
+func (f *FF1) num(z *big.Int, x []int) {
+	z.SetInt64(0)
+	digit := new(big.Int)
+	for _, numeral := range x {
+		z.Mul(z, f.radix)
+		z.Add(z, digit.SetInt64(int64(numeral)))
+	}
+}
+
+// str returns m numerals representing z, most significant first.
+func (f *FF1) str(z *big.Int, m int) []int {
+	x := make([]int, m)
+	z = new(big.Int).Set(z)
+	numeral := new(big.Int)
+	for i := m - 1; i >= 0; i-- {
+		z.DivMod(z, f.radix, numeral)
+		x[i] = int(numeral.Int64())
+	}
+	return x
+}
+
+// numerals converts s to numerals of the alphabet, validating its length.
+func (f *FF1) numerals(s string) ([]int, error) {
+	x := make([]int, 0, len(s))
+	for _, r := range s {
+		i, ok := f.index[r]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not in the alphabet", ErrInvalidFF1Input, r)
+		}
+		x = append(x, i)
+	}
+	domain := new(big.Int).Exp(f.radix, big.NewInt(int64(len(x))), nil)
+	if len(x) < 2 || domain.Cmp(big.NewInt(ff1MinDomain)) < 0 {
+		return nil, fmt.Errorf("%w: %d characters are too short for radix %d", ErrInvalidFF1Input, len(x), len(f.alphabet))
+	}
+	return x, nil
+}
+
+func (f *FF1) string(x []int) string {
+	runes := make([]rune, len(x))
+	for i, numeral := range x {
+		runes[i] = f.alphabet[numeral]
+	}
+	return string(runes)
+}
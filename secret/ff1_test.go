@@ -0,0 +1,127 @@
+package secret
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFF1Vectors(t *testing.T) {
+	// NIST SP 800-38G FF1 samples.
+	const (
+		aes128 = "2b7e151628aed2a6abf7158809cf4f3c"
+		aes192 = "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f"
+		aes256 = "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f7f036d6f04fc6a94"
+	)
+	for _, tc := range []struct {
+		name       string
+		key        string
+		alphabet   string
+		tweak      string
+		plaintext  string
+		ciphertext string
+	}{
+		{"sample 1", aes128, FF1Digits, "", "0123456789", "2433477484"},
+		{"sample 2", aes128, FF1Digits, "39383736353433323130", "0123456789", "6124200773"},
+		{"sample 3", aes128, FF1Alphanumeric, "3737373770717273373737", "0123456789abcdefghi", "a9tv40mll9kdu509eum"},
+		{"sample 4", aes192, FF1Digits, "", "0123456789", "2830668132"},
+		{"sample 5", aes192, FF1Digits, "39383736353433323130", "0123456789", "2496655549"},
+		{"sample 6", aes192, FF1Alphanumeric, "3737373770717273373737", "0123456789abcdefghi", "xbj3kv35jrawxv32ysr"},
+		{"sample 7", aes256, FF1Digits, "", "0123456789", "6657667009"},
+		{"sample 8", aes256, FF1Digits, "39383736353433323130", "0123456789", "1001623463"},
+		{"sample 9", aes256, FF1Alphanumeric, "3737373770717273373737", "0123456789abcdefghi", "xs8a0azh2avyalyzuwd"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := NewFF1(mustDecodeHex(t, tc.key), tc.alphabet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tweak := mustDecodeHex(t, tc.tweak)
+			ciphertext, err := f.Encrypt(tc.plaintext, tweak)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ciphertext != tc.ciphertext {
+				t.Fatalf("expecting %s, but received %s", tc.ciphertext, ciphertext)
+			}
+			plaintext, err := f.Decrypt(ciphertext, tweak)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plaintext != tc.plaintext {
+				t.Fatalf("expecting %s, but received %s", tc.plaintext, plaintext)
+			}
+		})
+	}
+}
+
+func TestFF1(t *testing.T) {
+	key, err := KeyFromString("955880d5f4f43c66751848c06fedb78e420995b373418dcfb856ca559deb71c3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	digits, err := NewFF1(key, FF1Digits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hex, err := NewFF1(key, "0123456789ABCDEF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unicode, err := NewFF1(key, "あいうえおかきくけこ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		f         *FF1
+		plaintext string
+	}{
+		{digits, "4111111111111111"},
+		{digits, "000000"},
+		{digits, "6505550123"},
+		{hex, "DEADBEEF"},
+		{hex, "00000"},
+		{unicode, "あいうえおかき"},
+		{digits, strings.Repeat("0123456789", 20)},
+	} {
+		ciphertext, err := tc.f.Encrypt(tc.plaintext, []byte("users.card"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len([]rune(ciphertext)) != len([]rune(tc.plaintext)) || ciphertext == tc.plaintext {
+			t.Fatalf("%s: unexpected ciphertext: %s", tc.plaintext, ciphertext)
+		}
+		for _, r := range ciphertext {
+			if _, ok := tc.f.index[r]; !ok {
+				t.Fatalf("%s: ciphertext %s is outside of the alphabet", tc.plaintext, ciphertext)
+			}
+		}
+		plaintext, err := tc.f.Decrypt(ciphertext, []byte("users.card"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext != tc.plaintext {
+			t.Fatalf("expecting %s, but received %s", tc.plaintext, plaintext)
+		}
+		if other, _ := tc.f.Encrypt(tc.plaintext, []byte("users.phone")); other == ciphertext {
+			t.Fatalf("%s: ciphertexts of different tweaks are unexpectedly equal", tc.plaintext)
+		}
+	}
+
+	for _, invalid := range []string{"", "12345", "12345a", "４１１１１１"} {
+		if _, err := digits.Encrypt(invalid, nil); !errors.Is(err, ErrInvalidFF1Input) {
+			t.Fatalf("%q: expecting ErrInvalidFF1Input, but received %v", invalid, err)
+		}
+	}
+	for _, alphabet := range []string{"", "0", "00123"} {
+		if _, err := NewFF1(key, alphabet); err == nil {
+			t.Fatalf("%q: invalid alphabet was unexpectedly accepted", alphabet)
+		}
+	}
+	if _, err := NewFF1(key[:7], FF1Digits); err == nil {
+		t.Fatal("invalid key was unexpectedly accepted")
+	}
+	if digits.Radix() != 10 || unicode.Radix() != 10 {
+		t.Fatalf("unexpected radix: %d, %d", digits.Radix(), unicode.Radix())
+	}
+}
@@ -0,0 +1,115 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Bytes and String implement flag.Value, so that secrets can be read from command line
+// flags without the plaintext appearing in usage (e.g. flag.PrintDefaults) or logs.
+
+var ErrMissingEnv = errors.New("missing environment variable")
+
+// Redacted replaces plaintext of secrets which have been set, as printed by String.
+const Redacted = "[REDACTED]"
+
+// EnvTag is the struct tag read by LoadEnv.
+const EnvTag = "env"
+
+// String implements fmt.Stringer (and flag.Value), returning Redacted instead of the
+// plaintext, or an empty string if the secret is empty.
+func (s Bytes) String() string {
+	if len(s.secret) == 0 {
+		return ""
+	}
+	return Redacted
+}
+
+// Set implements flag.Value, replacing plaintext with value. Values starting with "@"
+// are read from the file it references instead (e.g. "@/run/secrets/db_password"),
+// without a trailing newline, while values starting with "@@" are unescaped to "@".
+func (s *Bytes) Set(value string) error {
+	switch {
+	case strings.HasPrefix(value, "@@"):
+		value = value[1:]
+	case strings.HasPrefix(value, "@"):
+		b, err := os.ReadFile(value[1:])
+		if err != nil {
+			return err
+		}
+		if len(b) > 0 && b[len(b)-1] == '\n' {
+			b = b[:len(b)-1]
+			if len(b) > 0 && b[len(b)-1] == '\r' {
+				b = b[:len(b)-1]
+			}
+		}
+		s.secret = b
+		return nil
+	}
+	s.secret = []byte(value)
+	return nil
+}
+
+// LoadEnv populates fields of struct pointed by dst, which are tagged with the name of
+// environment variable (e.g. `env:"DB_PASSWORD"`), through their Set method (see
+// Bytes.Set), therefore "@" file references are supported. Tagged fields must implement
+// Set(string) error, such as Bytes, String, and Password, and untagged struct fields
+// are traversed.
+//
+// Fields of unset variables are left as is, unless tagged as required
+// (e.g. `env:"DB_PASSWORD,required"`), in which case error wrapping ErrMissingEnv is returned.
+func LoadEnv(dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expecting pointer to struct, received %T", dst)
+	}
+	return loadEnv(v.Elem())
+}
+
+type setter interface {
+	Set(string) error
+}
+
+func loadEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag, ok := field.Tag.Lookup(EnvTag)
+		if !ok {
+			if field.Type.Kind() == reflect.Struct {
+				if err := loadEnv(v.Field(i)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			return fmt.Errorf("%s: missing name of environment variable", field.Name)
+		}
+		s, ok := v.Field(i).Addr().Interface().(setter)
+		if !ok {
+			return fmt.Errorf("%s: %s does not implement Set(string) error", field.Name, field.Type)
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			if opts == "required" {
+				return fmt.Errorf("%s: %w %s", field.Name, ErrMissingEnv, name)
+			}
+			continue
+		}
+		if err := s.Set(value); err != nil {
+			return fmt.Errorf("%s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package secret
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// HMACWriter computes message authentication code (MAC) of everything written to it,
+// allowing large messages (e.g. files) to be authenticated without loading them into
+// memory. The result is identical to HMAC (or HMACCheck) of the concatenated writes.
+type HMACWriter struct {
+	hash     hash.Hash
+	nonce    []byte
+	expected []byte
+}
+
+// HMACWriterAuthenticator is implemented by authenticators which can authenticate
+// streamed messages through HMACWriter.
+type HMACWriterAuthenticator interface {
+	Authenticator
+	// NewHMACWriter returns HMACWriter whose MAC is consistent with HMACCheck.
+	NewHMACWriter() (*HMACWriter, error)
+	// NewHMACVerifier returns HMACWriter which validates MAC created by HMAC.
+	NewHMACVerifier(expected []byte) (*HMACWriter, error)
+}
+
+var _ HMACWriterAuthenticator = (*AESGCM)(nil)
+
+// NewHMACWriter returns HMACWriter with a random nonce, whose MAC is available from Sum.
+func (a *AESGCM) NewHMACWriter() (*HMACWriter, error) {
+	nonce := make([]byte, a.hmacNonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return a.newHMACWriter(nonce, nil), nil
+}
+
+// NewHMACVerifier returns HMACWriter which validates everything written to it against
+// expected MAC through Verify.
+func (a *AESGCM) NewHMACVerifier(expected []byte) (*HMACWriter, error) {
+	if len(expected) < a.hmacNonceLength {
+		return nil, ErrHMACMismatch
+	}
+	// Nonce should be copied over, so that expected is not modified by Sum.
+	nonce := make([]byte, a.hmacNonceLength)
+	copy(nonce, expected)
+	return a.newHMACWriter(nonce, expected), nil
+}
+
+func (a *AESGCM) newHMACWriter(nonce, expected []byte) *HMACWriter {
+	h := hmac.New(a.hmacHash, a.hmacKey)
+	h.Write(nonce)
+	return &HMACWriter{hash: h, nonce: nonce, expected: expected}
+}
+
+// Write adds more data to be authenticated. It never returns an error.
+func (w *HMACWriter) Write(p []byte) (int, error) {
+	return w.hash.Write(p)
+}
+
+// Sum returns nonce followed by MAC of the data written so far.
+func (w *HMACWriter) Sum() []byte {
+	result := make([]byte, 0, len(w.nonce)+w.hash.Size())
+	result = append(result, w.nonce...)
+	return w.hash.Sum(result)
+}
+
+// Verify validates if the data written so far is consistent with MAC provided to
+// NewHMACVerifier, returning ErrHMACMismatch otherwise.
+func (w *HMACWriter) Verify() error {
+	if w.expected == nil || !hmac.Equal(w.Sum(), w.expected) {
+		return ErrHMACMismatch
+	}
+	return nil
+}
+
+// writeMACEntry writes length-prefixed key and value to w, so that a MAC over the
+// entries is unambiguous regardless of their content.
+func writeMACEntry(w io.Writer, key string, value []byte) {
+	fmt.Fprintf(w, "%d:%s=%d:%s\n", len(key), key, len(value), value)
+}
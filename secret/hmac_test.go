@@ -0,0 +1,118 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestHMACOptions(t *testing.T) {
+	key, err := KeyFromString(testStringKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		opts     []Option
+		expected int
+	}{
+		{nil, 16 + 32},
+		{[]Option{WithHMACHash(sha512.New384)}, 16 + 48},
+		{[]Option{WithHMACHash(sha512.New), WithHMACNonceLength(32)}, 32 + 64},
+		{[]Option{WithHMACNonceLength(0)}, 32},
+	}
+	msg := []byte(`carby is best kirby`)
+	for _, c := range cases {
+		auth, err := NewAuthenticatorAESGCM(key, c.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mac, err := auth.HMAC(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mac) != c.expected {
+			t.Fatalf("expected MAC length %d, received %d", c.expected, len(mac))
+		}
+		if err := auth.HMACCheck(msg, mac); err != nil {
+			t.Fatal(err)
+		}
+		if err := getAuth().HMACCheck(msg, mac); err != ErrHMACMismatch && c.opts != nil {
+			t.Fatalf("expecting ErrHMACMismatch with default options, received %v", err)
+		}
+	}
+
+	if _, err := NewAuthenticatorAESGCM(key, WithHMACNonceLength(-1)); err == nil {
+		t.Fatal("negative nonce length was unexpectedly accepted")
+	}
+}
+
+func TestHMACWriter(t *testing.T) {
+	auth := getAuth()
+	// 4 MiB of data, written in chunks by io.Copy.
+	data := bytes.Repeat([]byte(`never gonna give you up `), 1<<17)
+
+	w, err := auth.NewHMACWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	mac := w.Sum()
+	if err := auth.HMACCheck(data, mac); err != nil {
+		t.Fatalf("streamed MAC is inconsistent with HMACCheck: %v", err)
+	}
+
+	v, err := auth.NewHMACVerifier(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(v, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err = auth.NewHMACVerifier(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(v, bytes.NewReader(data[1:])); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(); err != ErrHMACMismatch {
+		t.Fatalf("expecting ErrHMACMismatch, received %v", err)
+	}
+}
+
+func TestHMACWriterAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	m := getSubjectKeyManager(t, NewMemorySubjectKeyStore())
+	kirby, err := m.AuthenticatorFor(ctx, "kirby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, ok := kirby.(HMACWriterAuthenticator)
+	if !ok {
+		t.Fatalf("%T does not implement HMACWriterAuthenticator", kirby)
+	}
+	w, err := auth.NewHMACWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "poyo")
+	if err := kirby.HMACCheck([]byte("poyo"), w.Sum()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Shred(ctx, "kirby"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.NewHMACWriter(); !errors.Is(err, ErrKeyShredded) {
+		t.Fatalf("expecting ErrKeyShredded, received %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown format")
+)
+
+const (
+	FormatAESGCM = "aes-gcm"
+	FormatHMAC   = "hmac"
+	FormatFernet = "fernet"
+	FormatJWE    = "jwe"
+	FormatPaseto = "paseto"
+)
+
+const (
+	aesGCMNonceLength = 12
+	aesGCMTagLength   = 16
+)
+
+// Inspection describes the structure of a ciphertext or MAC, as reported by Inspect.
+// Fields which are not available in the format are left empty.
+type Inspection struct {
+	// Format is one of FormatAESGCM, FormatHMAC, FormatFernet, FormatJWE, or FormatPaseto.
+	Format string
+	// Alternatives are other formats which share the same structure, as some formats
+	// (e.g. AES-GCM ciphertext and HMAC) are indistinguishable without the key.
+	Alternatives []string
+	// Encoding is text encoding of AES-GCM ciphertexts and MACs (see WithEncoding).
+	Encoding  Encoding
+	Version   string
+	Algorithm string
+	KeyID     string
+	Nonce     []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// Size is length of the decoded value in bytes. JWE consists of multiple encoded
+	// segments, hence its size is their total length.
+	Size int
+	// CiphertextSize is length of the encrypted (or signed) payload in bytes.
+	CiphertextSize int
+	// TagSize is length of the authentication tag, MAC, or signature in bytes.
+	TagSize int
+}
+
+// Inspect parses text representation of a ciphertext (e.g. output of EncryptBase64,
+// MarshalText in any Encoding, Fernet, JWE, or PASETO tokens) or MAC (encoded output
+// of HMAC) and reports its structure, without requiring the key.
+func Inspect(text []byte) (*Inspection, error) {
+	text = bytes.TrimSpace(text)
+	switch {
+	case bytes.HasPrefix(text, []byte(pasetoV3LocalHeader)), bytes.HasPrefix(text, []byte(pasetoV3PublicHeader)):
+		return inspectPaseto(text)
+	case bytes.Count(text, []byte(".")) == 4:
+		return inspectJWE(text)
+	}
+
+	data, encoding, err := decodeInspected(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+	// Fernet tokens are Base64URL-encoded, and padded unless their length is a multiple
+	// of 3 bytes, unlike output of EncryptBase64.
+	if encoding == EncodingBase64URL && isFernet(data) {
+		i := inspectFernet(data)
+		if !bytes.HasSuffix(text, []byte("=")) {
+			i.Alternatives = append(i.Alternatives, FormatAESGCM)
+		}
+		return i, nil
+	}
+	// Other than Fernet tokens, only EncodingBase64 is padded.
+	if encoding == EncodingBase64URL && bytes.HasSuffix(text, []byte("=")) && !bytes.ContainsAny(text, "-_") {
+		encoding = EncodingBase64
+	}
+
+	var i *Inspection
+	switch {
+	case len(data) >= aesGCMNonceLength+aesGCMTagLength:
+		if i = inspectExpiring(data); i == nil {
+			i = &Inspection{
+				Format:         FormatAESGCM,
+				Algorithm:      "AES-GCM",
+				Nonce:          data[:aesGCMNonceLength],
+				Size:           len(data),
+				CiphertextSize: len(data) - aesGCMNonceLength - aesGCMTagLength,
+				TagSize:        aesGCMTagLength,
+			}
+		}
+		// Length of MACs depends on WithHMACHash and WithHMACNonceLength, hence any
+		// ciphertext may be a MAC as well.
+		i.Alternatives = append(i.Alternatives, FormatHMAC)
+	case len(data) >= hmacMinLength:
+		// Too short to be a ciphertext, yet long enough to be MAC of a shorter nonce.
+		i = &Inspection{Format: FormatHMAC, Size: len(data)}
+	default:
+		return nil, fmt.Errorf("%w: %d bytes is too short", ErrUnknownFormat, len(data))
+	}
+	i.Encoding = encoding
+	return i, nil
+}
+
+// hmacMinLength is length of the shortest MAC reported by Inspect, i.e. 128 bits.
+const hmacMinLength = 16
+
+// decodeInspected decodes text with the most specific encoding it may be encoded with
+// (see inspectEncodings).
+func decodeInspected(text []byte) ([]byte, Encoding, error) {
+	var err error
+	for _, e := range inspectEncodings(text) {
+		var data []byte
+		if e == EncodingBase64URL && bytes.HasSuffix(text, []byte("=")) {
+			data, err = base64.URLEncoding.DecodeString(string(text))
+		} else {
+			data, err = e.Decode(text)
+		}
+		if err == nil {
+			return data, e, nil
+		}
+	}
+	return nil, 0, err
+}
+
+// inspectEncodings returns encodings which text may be encoded with, the most specific
+// first. Alphabets of hexadecimal and Crockford's Base32 are subsets of Base64, yet text
+// of Base64-encoded ciphertexts practically never consists of their characters alone.
+// Base64 and Base64URL differ in 2 characters only, hence are told apart by them (or
+// by padding, see Inspect), otherwise both decode identically.
+func inspectEncodings(text []byte) []Encoding {
+	s := string(text)
+	var candidates []Encoding
+	if strings.Trim(s, "0123456789abcdef") == "" {
+		candidates = append(candidates, EncodingHex)
+	}
+	if strings.Trim(s, "0123456789ABCDEFGHJKMNPQRSTVWXYZ") == "" {
+		candidates = append(candidates, EncodingBase32Crockford)
+	}
+	if strings.ContainsAny(s, "+/") {
+		candidates = append(candidates, EncodingBase64)
+	}
+	return append(candidates, EncodingBase64URL)
+}
+
+func isFernet(data []byte) bool {
+	return len(data) >= fernetMinLength && data[0] == fernetVersion &&
+		(len(data)-fernetHeaderLength-sha256.Size)%aes.BlockSize == 0
+}
+
+func inspectFernet(data []byte) *Inspection {
+	return &Inspection{
+		Format:         FormatFernet,
+		Version:        fmt.Sprintf("0x%x", data[0]),
+		Algorithm:      "AES-128-CBC+HMAC-SHA256",
+		Nonce:          data[9:fernetHeaderLength],
+		CreatedAt:      time.Unix(int64(binary.BigEndian.Uint64(data[1:9])), 0).UTC(),
+		Size:           len(data),
+		CiphertextSize: len(data) - fernetHeaderLength - sha256.Size,
+		TagSize:        sha256.Size,
+	}
+}
+
+// Timestamps of expiring ciphertexts outside of this range are considered implausible.
+var (
+	inspectMinTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	inspectMaxTime = time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// inspectExpiring reports AES-GCM ciphertext with expiry (see EncryptWithExpiry),
+// or nil if data does not resemble one.
+func inspectExpiring(data []byte) *Inspection {
+	headerLength := aesGCMExpiringHeaderLength + aesGCMNonceLength
+	if len(data) < headerLength+aesGCMTagLength || data[0] != aesGCMExpiringVersion {
+		return nil
+	}
+	issuedAt := time.Unix(int64(binary.BigEndian.Uint64(data[1:9])), 0).UTC()
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(data[9:17])), 0).UTC()
+	// Random nonce of ciphertext without expiry starts with the version once in 256
+	// ciphertexts, whose timestamps are practically never within plausible range.
+	if issuedAt.Before(inspectMinTime) || expiresAt.After(inspectMaxTime) || expiresAt.Before(issuedAt) {
+		return nil
+	}
+	return &Inspection{
+		Format:         FormatAESGCM,
+		Version:        fmt.Sprintf("0x%x (expiring)", data[0]),
+		Algorithm:      "AES-GCM",
+		Nonce:          data[aesGCMExpiringHeaderLength:headerLength],
+		CreatedAt:      issuedAt,
+		ExpiresAt:      expiresAt,
+		Size:           len(data),
+		CiphertextSize: len(data) - headerLength - aesGCMTagLength,
+		TagSize:        aesGCMTagLength,
+	}
+}
+
+func inspectJWE(text []byte) (*Inspection, error) {
+	parts := bytes.Split(text, []byte("."))
+	header, err := parseJWEHeader(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+	// Segments are protected header, encrypted key, iv, ciphertext, and tag.
+	segments := make([][]byte, 5)
+	size := 0
+	for i, part := range parts {
+		if segments[i], err = decodeBase64(part); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+		}
+		size += len(segments[i])
+	}
+	return &Inspection{
+		Format:         FormatJWE,
+		Algorithm:      header.Algorithm + "+" + header.Encryption,
+		KeyID:          header.KeyID,
+		Nonce:          segments[2],
+		Size:           size,
+		CiphertextSize: len(segments[3]),
+		TagSize:        len(segments[4]),
+	}, nil
+}
+
+func inspectPaseto(text []byte) (*Inspection, error) {
+	header := pasetoV3LocalHeader
+	if bytes.HasPrefix(text, []byte(pasetoV3PublicHeader)) {
+		header = pasetoV3PublicHeader
+	}
+	body, footer, err := decodePaseto(header, text, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+	i := &Inspection{
+		Format:  FormatPaseto,
+		Version: strings.TrimSuffix(header, "."),
+		Size:    len(body),
+	}
+	// Footer is conventionally JSON object which may contain key ID.
+	meta := struct {
+		KeyID string `json:"kid"`
+	}{}
+	if json.Unmarshal(footer, &meta) == nil {
+		i.KeyID = meta.KeyID
+	}
+
+	if header == pasetoV3LocalHeader {
+		if len(body) < pasetoV3NonceLength+pasetoV3MACLength {
+			return nil, fmt.Errorf("%w: token is too short", ErrUnknownFormat)
+		}
+		i.Algorithm = "AES-256-CTR+HMAC-SHA384"
+		i.Nonce = body[:pasetoV3NonceLength]
+		i.CiphertextSize = len(body) - pasetoV3NonceLength - pasetoV3MACLength
+		i.TagSize = pasetoV3MACLength
+		return i, nil
+	}
+
+	if len(body) < pasetoV3SignatureLength {
+		return nil, fmt.Errorf("%w: token is too short", ErrUnknownFormat)
+	}
+	i.Algorithm = "ECDSA-P384-SHA384"
+	i.CiphertextSize = len(body) - pasetoV3SignatureLength
+	i.TagSize = pasetoV3SignatureLength
+	// Payload of public tokens is not encrypted, therefore issued-at claim is readable.
+	claims := struct {
+		IssuedAt time.Time `json:"iat"`
+	}{}
+	if json.Unmarshal(body[:i.CiphertextSize], &claims) == nil {
+		i.CreatedAt = claims.IssuedAt
+	}
+	return i, nil
+}
+
+// String formats inspection as human-readable report.
+func (i *Inspection) String() string {
+	var b strings.Builder
+	field := func(name string, value any) {
+		fmt.Fprintf(&b, "%-16s %v\n", name+":", value)
+	}
+	field("format", i.Format)
+	if len(i.Alternatives) > 0 {
+		field("could also be", strings.Join(i.Alternatives, ", "))
+	}
+	if i.Encoding != 0 {
+		field("encoding", i.Encoding)
+	}
+	if i.Version != "" {
+		field("version", i.Version)
+	}
+	if i.Algorithm != "" {
+		field("algorithm", i.Algorithm)
+	}
+	if i.KeyID != "" {
+		field("key id", i.KeyID)
+	}
+	if len(i.Nonce) > 0 {
+		field("nonce", hex.EncodeToString(i.Nonce))
+	}
+	if !i.CreatedAt.IsZero() {
+		field("created at", i.CreatedAt.Format(time.RFC3339))
+	}
+	if !i.ExpiresAt.IsZero() {
+		field("expires at", i.ExpiresAt.Format(time.RFC3339))
+	}
+	field("size", i.Size)
+	field("ciphertext size", i.CiphertextSize)
+	field("tag size", i.TagSize)
+	return b.String()
+}
@@ -0,0 +1,180 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha512"
+	"testing"
+	"time"
+)
+
+func TestInspectAESGCM(t *testing.T) {
+	auth := getAuth()
+	ciphertext, err := auth.EncryptBase64([]byte(`carby is best kirby`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := Inspect(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("inspection:\n%s", i)
+	if i.Format != FormatAESGCM || len(i.Nonce) != 12 || i.CiphertextSize != 19 || i.TagSize != 16 {
+		t.Fatalf("unexpected inspection: %+v", i)
+	}
+}
+
+func TestInspectHMAC(t *testing.T) {
+	mac, err := getAuth().HMAC([]byte(`mario`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := Inspect(encodeBase64(mac))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(i.Alternatives) != 1 || i.Alternatives[0] != FormatHMAC {
+		t.Fatalf("expected HMAC to be an alternative, received %+v", i)
+	}
+}
+
+func TestInspectEncodings(t *testing.T) {
+	// 47 bytes, so that Base64 is padded.
+	ciphertext, err := getAuth().Encrypt([]byte(`carby is best kirby`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range encodings {
+		i, err := Inspect(e.Encode(ciphertext))
+		if err != nil {
+			t.Fatalf("%s: %v", e, err)
+		}
+		if i.Format != FormatAESGCM || i.Encoding != e || i.CiphertextSize != 19 || !bytes.Equal(i.Nonce, ciphertext[:aesGCMNonceLength]) {
+			t.Fatalf("%s: unexpected inspection: %+v", e, i)
+		}
+	}
+}
+
+func TestInspectHMACOptions(t *testing.T) {
+	key, err := KeyFromString(testStringKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		opts   []Option
+		format string
+	}{
+		{[]Option{WithHMACHash(sha512.New)}, FormatAESGCM},
+		{[]Option{WithHMACHash(sha512.New384), WithHMACNonceLength(0)}, FormatAESGCM},
+		{[]Option{WithHMACNonceLength(0)}, FormatAESGCM},
+		{[]Option{WithHMACHash(sha1.New), WithHMACNonceLength(4)}, FormatHMAC},
+	} {
+		auth, err := NewAuthenticatorAESGCM(key, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mac, err := auth.HMAC([]byte(`mario`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		i, err := Inspect(encodeBase64(mac))
+		if err != nil {
+			t.Fatalf("%d bytes MAC: %v", len(mac), err)
+		}
+		isHMAC := i.Format == FormatHMAC
+		for _, alt := range i.Alternatives {
+			isHMAC = isHMAC || alt == FormatHMAC
+		}
+		if i.Format != tc.format || !isHMAC || i.Size != len(mac) {
+			t.Fatalf("%d bytes MAC: unexpected inspection: %+v", len(mac), i)
+		}
+	}
+}
+
+// TestInspectExpiringVersion ensures ciphertexts without expiry are not mistaken for
+// expiring ones, as their random nonce may start with the version.
+func TestInspectExpiringVersion(t *testing.T) {
+	auth := getAuth()
+	plain, err := auth.Encrypt([]byte(`carby is best kirby`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain[0] = aesGCMExpiringVersion
+	i, err := Inspect(encodeBase64(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Version != "" || !i.CreatedAt.IsZero() || !i.ExpiresAt.IsZero() || i.CiphertextSize != 19 || !bytes.Equal(i.Nonce, plain[:aesGCMNonceLength]) {
+		t.Fatalf("unexpected inspection: %+v", i)
+	}
+}
+
+func TestInspectFernet(t *testing.T) {
+	i, err := Inspect([]byte(fernetVectorToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("inspection:\n%s", i)
+	expected := time.Date(1985, 10, 26, 8, 20, 0, 0, time.UTC)
+	if i.Format != FormatFernet || !i.CreatedAt.Equal(expected) || i.CiphertextSize != 16 || len(i.Alternatives) != 0 {
+		t.Fatalf("unexpected inspection: %+v", i)
+	}
+}
+
+func TestInspectJWE(t *testing.T) {
+	auth, err := NewAuthenticatorJWE(JWEA256KW, getJWEKey(t, "2022-01"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.Encrypt([]byte(`still alive`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := Inspect(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("inspection:\n%s", i)
+	if i.Format != FormatJWE || i.KeyID != "2022-01" || i.Algorithm != "A256KW+A256GCM" || i.CiphertextSize != 11 {
+		t.Fatalf("unexpected inspection: %+v", i)
+	}
+	// Protected header, 40 bytes encrypted key, 12 bytes iv, ciphertext, and 16 bytes tag.
+	header, err := decodeBase64(bytes.SplitN(token, []byte("."), 2)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := len(header) + 40 + 12 + 11 + 16; i.Size != expected {
+		t.Fatalf("expecting size %d, received %d", expected, i.Size)
+	}
+}
+
+func TestInspectPaseto(t *testing.T) {
+	key, err := NewKey(PasetoV3LocalKeyLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPasetoV3Local(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := p.Encrypt([]byte(`{"data":"x"}`), []byte(`{"kid":"k1"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := Inspect(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("inspection:\n%s", i)
+	if i.Format != FormatPaseto || i.Version != "v3.local" || i.KeyID != "k1" || i.CiphertextSize != 12 {
+		t.Fatalf("unexpected inspection: %+v", i)
+	}
+}
+
+func TestInspectUnknown(t *testing.T) {
+	for _, text := range []string{"", "not base64!", "c2hvcnQ"} {
+		if _, err := Inspect([]byte(text)); err == nil {
+			t.Errorf("inspecting %q unexpectedly succeeded", text)
+		}
+	}
+}
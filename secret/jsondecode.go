@@ -0,0 +1,303 @@
+package secret
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// decodeJSON decodes data into v, which must be addressable, similar to json.Unmarshal.
+// Values which may hold secrets are walked here, so that secret values created while
+// decoding are bound to auth before they are decrypted. Everything else is decoded by
+// json.Unmarshal. If strict, secret values which could not be bound are refused.
+func decodeJSON(data []byte, v reflect.Value, auth Authenticator, strict bool) error {
+	t := v.Type()
+	if !mayContainBytes(t, map[reflect.Type]bool{}) || bytes.Equal(data, []byte("null")) {
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+	if t.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return decodeJSON(data, v.Elem(), auth, strict)
+	}
+	if t.Kind() == reflect.Interface {
+		// Similar to json.Unmarshal, non-nil pointers are decoded into.
+		if !v.IsNil() && v.Elem().Kind() == reflect.Pointer && !v.Elem().IsNil() {
+			return decodeJSON(data, v.Elem().Elem(), auth, strict)
+		}
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+	if pt := reflect.PointerTo(t); pt.Implements(jsonUnmarshalerType) || pt.Implements(textUnmarshalerType) {
+		// Including Bytes and String, which are bound beforehand.
+		bind(v, auth, map[uintptr]bool{})
+		if err := json.Unmarshal(data, v.Addr().Interface()); err != nil {
+			return err
+		}
+		if strict && unbound(v, map[uintptr]bool{}) {
+			return fmt.Errorf("unable to decode: %s created secret values which are not bound to authenticator of context, use Bind", t)
+		}
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		members, err := jsonMembers(data)
+		if err != nil {
+			return json.Unmarshal(data, v.Addr().Interface())
+		}
+		fields := jsonFields(t)
+		for _, m := range members {
+			f, ok := fields.lookup(m.key)
+			if !ok {
+				continue
+			}
+			fv, err := jsonFieldByIndex(v, f.index)
+			if err != nil {
+				return err
+			}
+			if f.quoted && !mayContainBytes(fv.Type(), map[reflect.Type]bool{}) {
+				err = decodeQuotedJSON(m.value, fv)
+			} else {
+				err = decodeJSON(m.value, fv, auth, strict)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		members, err := jsonMembers(data)
+		if err != nil {
+			return json.Unmarshal(data, v.Addr().Interface())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(t, len(members)))
+		}
+		for _, m := range members {
+			key := reflect.New(t.Key())
+			// Integer keys are quoted in JSON, unlike integers.
+			rawKey, _ := json.Marshal(m.key)
+			if k := t.Key().Kind(); k >= reflect.Int && k <= reflect.Uintptr && !reflect.PointerTo(t.Key()).Implements(textUnmarshalerType) {
+				rawKey = []byte(m.key)
+			}
+			if err := json.Unmarshal(rawKey, key.Interface()); err != nil {
+				return fmt.Errorf("unable to decode map key %q: %w", m.key, err)
+			}
+			elem := reflect.New(t.Elem()).Elem()
+			if err := decodeJSON(m.value, elem, auth, strict); err != nil {
+				return err
+			}
+			v.SetMapIndex(key.Elem(), elem)
+		}
+	case reflect.Slice, reflect.Array:
+		var elems []json.RawMessage
+		if err := json.Unmarshal(data, &elems); err != nil {
+			return json.Unmarshal(data, v.Addr().Interface())
+		}
+		if t.Kind() == reflect.Slice {
+			n := len(elems)
+			if v.IsNil() || v.Cap() < n {
+				grown := reflect.MakeSlice(t, v.Len(), n)
+				reflect.Copy(grown, v)
+				v.Set(grown)
+			}
+			previous := v.Len()
+			v.SetLen(n)
+			// Elements beyond the previous length are zeroed, rather than reused.
+			for i := previous; i < n; i++ {
+				v.Index(i).Set(reflect.Zero(t.Elem()))
+			}
+		}
+		for i := 0; i < v.Len(); i++ {
+			if i >= len(elems) {
+				v.Index(i).Set(reflect.Zero(t.Elem()))
+				continue
+			}
+			if err := decodeJSON(elems[i], v.Index(i), auth, strict); err != nil {
+				return err
+			}
+		}
+	default:
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+	return nil
+}
+
+// decodeQuotedJSON decodes data into v as a field with ",string" option.
+func decodeQuotedJSON(data []byte, v reflect.Value) error {
+	wrapper := reflect.New(reflect.StructOf([]reflect.StructField{
+		{Name: "V", Type: v.Type(), Tag: `json:"v,string"`},
+	}))
+	wrapper.Elem().Field(0).Set(v)
+	if err := json.Unmarshal(append(append([]byte(`{"v":`), data...), '}'), wrapper.Interface()); err != nil {
+		return err
+	}
+	v.Set(wrapper.Elem().Field(0))
+	return nil
+}
+
+type jsonMember struct {
+	key   string
+	value json.RawMessage
+}
+
+// jsonMembers returns members of JSON object data in order.
+func jsonMembers(data []byte) ([]jsonMember, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("expected JSON object")
+	}
+	var members []jsonMember
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		m := jsonMember{key: tok.(string)}
+		if err := dec.Decode(&m.value); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+type jsonField struct {
+	name   string
+	tagged bool
+	quoted bool
+	index  []int
+}
+
+type jsonFieldList []jsonField
+
+// lookup returns field by its name, preferring an exact match over a case-insensitive
+// one, as json.Unmarshal does.
+func (fields jsonFieldList) lookup(name string) (jsonField, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return jsonField{}, false
+}
+
+// jsonFields returns fields of struct type t decoded by json.Unmarshal, following its
+// rules: fields of embedded structs are promoted unless named by a tag, and among
+// fields of the same name, the shallowest one is decoded (tagged ones take precedence
+// at the same depth, otherwise all of them are ignored).
+func jsonFields(t reflect.Type) jsonFieldList {
+	type queued struct {
+		typ   reflect.Type
+		index []int
+	}
+	var candidates jsonFieldList
+	next := []queued{{typ: t}}
+	visited := map[reflect.Type]bool{}
+	for len(next) > 0 {
+		current := next
+		next = nil
+		for _, q := range current {
+			if visited[q.typ] {
+				continue
+			}
+			visited[q.typ] = true
+			for i := 0; i < q.typ.NumField(); i++ {
+				sf := q.typ.Field(i)
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous {
+					if !sf.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+				index := append(q.index[:len(q.index):len(q.index)], i)
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, queued{typ: ft, index: index})
+					continue
+				}
+				f := jsonField{name: name, tagged: name != "", index: index}
+				if name == "" {
+					f.name = sf.Name
+				}
+				for _, opt := range strings.Split(opts, ",") {
+					f.quoted = f.quoted || opt == "string"
+				}
+				candidates = append(candidates, f)
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if len(a.index) != len(b.index) {
+			return len(a.index) < len(b.index)
+		}
+		return a.tagged && !b.tagged
+	})
+	var fields jsonFieldList
+	for i := 0; i < len(candidates); {
+		j := i + 1
+		for j < len(candidates) && candidates[j].name == candidates[i].name {
+			j++
+		}
+		if j-i == 1 || len(candidates[i].index) < len(candidates[i+1].index) || candidates[i].tagged != candidates[i+1].tagged {
+			fields = append(fields, candidates[i])
+		}
+		i = j
+	}
+	// Case-insensitive matches are attempted in order of declaration.
+	sort.SliceStable(fields, func(i, j int) bool {
+		a, b := fields[i].index, fields[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return fields
+}
+
+// jsonFieldByIndex returns field of struct v at index, allocating embedded pointers.
+func jsonFieldByIndex(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("json: cannot set embedded pointer to unexported struct: %v", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
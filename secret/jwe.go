@@ -0,0 +1,296 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidJWE = errors.New("invalid jwe")
+)
+
+const (
+	// JWEDirect uses the key directly as content encryption key.
+	JWEDirect = "dir"
+	// JWEA256KW wraps a random content encryption key with the key (RFC 3394).
+	JWEA256KW = "A256KW"
+
+	jweEncryption = "A256GCM"
+	jweIVLength   = 12
+	jweTagLength  = 16
+)
+
+var _ Base64Authenticator = (*JWE)(nil)
+
+// JWEKey is a 256-bit key identified by ID, which is emitted as "kid" header
+// to select the key on decryption.
+type JWEKey struct {
+	ID  string
+	Key []byte
+}
+
+// JWE is an Authenticator which outputs JWE compact serialization (RFC 7516) with
+// "A256GCM" content encryption, therefore can be exchanged with any standards-compliant
+// JOSE library.
+//
+// Multiple keys are supported for rotation: the first key is used to encrypt, while
+// the key to decrypt is selected by "kid" header (or all keys are attempted without one).
+type JWE struct {
+	algorithm string
+	keys      []JWEKey
+	// hmacKeys are derived from keys, so that HMAC never uses content encryption keys
+	// (or key encryption keys) directly.
+	hmacKeys [][]byte
+}
+
+type jweHeader struct {
+	Algorithm  string          `json:"alg"`
+	Encryption string          `json:"enc"`
+	KeyID      string          `json:"kid,omitempty"`
+	Zip        string          `json:"zip,omitempty"`
+	Critical   json.RawMessage `json:"crit,omitempty"`
+}
+
+// NewAuthenticatorJWE creates JWE authenticator using algorithm (JWEDirect or JWEA256KW)
+// for key management.
+func NewAuthenticatorJWE(algorithm string, keys ...JWEKey) (*JWE, error) {
+	if algorithm != JWEDirect && algorithm != JWEA256KW {
+		return nil, fmt.Errorf("unsupported jwe algorithm: %q", algorithm)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwe requires at least one key")
+	}
+	j := &JWE{algorithm: algorithm, keys: keys}
+	for _, k := range keys {
+		if len(k.Key) != AES256KeyLength {
+			return nil, fmt.Errorf("jwe key %q: expected %d bytes, actual %d", k.ID, AES256KeyLength, len(k.Key))
+		}
+		j.hmacKeys = append(j.hmacKeys, hkdf(sha256.New, k.Key, nil, []byte("secret-jwe-hmac"), sha256.Size))
+	}
+	return j, nil
+}
+
+// Encrypt takes in secret and outputs JWE compact serialization.
+func (j *JWE) Encrypt(secret []byte) ([]byte, error) {
+	key := j.keys[0]
+	header, err := json.Marshal(jweHeader{Algorithm: j.algorithm, Encryption: jweEncryption, KeyID: key.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	cek := key.Key
+	var encryptedKey []byte
+	if j.algorithm == JWEA256KW {
+		cek, err = NewKey(AES256KeyLength)
+		if err != nil {
+			return nil, err
+		}
+		encryptedKey, err = aesKeyWrap(key.Key, cek)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	aead, err := newJWEAEAD(cek)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, jweIVLength)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	protected := []byte(base64.RawURLEncoding.EncodeToString(header))
+	sealed := aead.Seal(nil, iv, secret, protected)
+	ciphertext, tag := sealed[:len(sealed)-jweTagLength], sealed[len(sealed)-jweTagLength:]
+
+	return bytes.Join([][]byte{
+		protected,
+		encodeBase64(encryptedKey),
+		encodeBase64(iv),
+		encodeBase64(ciphertext),
+		encodeBase64(tag),
+	}, []byte(".")), nil
+}
+
+// EncryptBase64 is identical to Encrypt, as JWE compact serialization is already base64-encoded.
+func (j *JWE) EncryptBase64(secret []byte) ([]byte, error) {
+	return j.Encrypt(secret)
+}
+
+// Decrypt takes in JWE compact serialization and outputs secret.
+func (j *JWE) Decrypt(data []byte) ([]byte, error) {
+	parts := bytes.Split(data, []byte("."))
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("%w: expected 5 segments, actual %d", ErrInvalidJWE, len(parts))
+	}
+	header, err := parseJWEHeader(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if header.Algorithm != j.algorithm {
+		return nil, fmt.Errorf("%w: expected alg %q, actual %q", ErrInvalidJWE, j.algorithm, header.Algorithm)
+	}
+	if header.Encryption != jweEncryption {
+		return nil, fmt.Errorf("%w: unsupported enc %q", ErrInvalidJWE, header.Encryption)
+	}
+	if header.Zip != "" || len(header.Critical) > 0 {
+		return nil, fmt.Errorf("%w: unsupported zip or crit header", ErrInvalidJWE)
+	}
+
+	segments := make([][]byte, 4)
+	for i, part := range parts[1:] {
+		segments[i], err = decodeBase64(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidJWE, err)
+		}
+	}
+	encryptedKey, iv, ciphertext, tag := segments[0], segments[1], segments[2], segments[3]
+	if len(iv) != jweIVLength || len(tag) != jweTagLength {
+		return nil, fmt.Errorf("%w: invalid iv or tag length", ErrInvalidJWE)
+	}
+	sealed := append(ciphertext, tag...)
+
+	for _, key := range j.keys {
+		if header.KeyID != "" && header.KeyID != key.ID {
+			continue
+		}
+		cek := key.Key
+		if j.algorithm == JWEA256KW {
+			if cek, err = aesKeyUnwrap(key.Key, encryptedKey); err != nil {
+				continue
+			}
+			// A256GCM requires 256-bit key, while aes.NewCipher would accept shorter keys.
+			if len(cek) != AES256KeyLength {
+				continue
+			}
+		} else if len(encryptedKey) != 0 {
+			return nil, fmt.Errorf("%w: encrypted key must be empty for %q", ErrInvalidJWE, JWEDirect)
+		}
+		aead, err := newJWEAEAD(cek)
+		if err != nil {
+			continue
+		}
+		if secret, err := aead.Open(nil, iv, sealed, parts[0]); err == nil {
+			return secret, nil
+		}
+	}
+	return nil, ErrInvalidJWE
+}
+
+// DecryptBase64 is identical to Decrypt, as JWE compact serialization is already base64-encoded.
+func (j *JWE) DecryptBase64(data []byte) ([]byte, error) {
+	return j.Decrypt(data)
+}
+
+// HMAC creates a message authentication code (MAC) for a given message with
+// nonce prefix, using a key derived from the first key.
+func (j *JWE) HMAC(msg []byte) ([]byte, error) {
+	nonce := make([]byte, hmacNonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return calcNonceHMAC(j.hmacKeys[0], nonce, msg), nil
+}
+
+// HMACCheck validates if a message and its MAC is consistent with any of the keys.
+func (j *JWE) HMACCheck(msg, expected []byte) error {
+	if len(expected) < hmacNonceLength {
+		return ErrHMACMismatch
+	}
+	for _, k := range j.hmacKeys {
+		if hmac.Equal(calcNonceHMAC(k, expected[:hmacNonceLength], msg), expected) {
+			return nil
+		}
+	}
+	return ErrHMACMismatch
+}
+
+func parseJWEHeader(protected []byte) (*jweHeader, error) {
+	raw, err := decodeBase64(protected)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJWE, err)
+	}
+	header := &jweHeader{}
+	if err := json.Unmarshal(raw, header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJWE, err)
+	}
+	return header, nil
+}
+
+func newJWEAEAD(cek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+var aesKeyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// aesKeyWrap implements AES Key Wrap as defined by RFC 3394, section 2.2.1.
+func aesKeyWrap(kek, plaintext []byte) ([]byte, error) {
+	if len(plaintext)%8 != 0 || len(plaintext) < 16 {
+		return nil, fmt.Errorf("key wrap: plaintext must be a multiple of 8 bytes, at least 16 bytes")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(plaintext) / 8
+	result := make([]byte, 8+len(plaintext))
+	copy(result, aesKeyWrapIV)
+	copy(result[8:], plaintext)
+
+	buf := make([]byte, aes.BlockSize)
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(buf, result[:8])
+			copy(buf[8:], result[i*8:i*8+8])
+			block.Encrypt(buf, buf)
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(result[:8], binary.BigEndian.Uint64(buf[:8])^t)
+			copy(result[i*8:], buf[8:])
+		}
+	}
+	return result, nil
+}
+
+// aesKeyUnwrap implements AES Key Unwrap as defined by RFC 3394, section 2.2.2.
+func aesKeyUnwrap(kek, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext)%8 != 0 || len(ciphertext) < 24 {
+		return nil, fmt.Errorf("key unwrap: ciphertext must be a multiple of 8 bytes, at least 24 bytes")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(ciphertext)/8 - 1
+	result := make([]byte, len(ciphertext))
+	copy(result, ciphertext)
+
+	buf := make([]byte, aes.BlockSize)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(buf[:8], binary.BigEndian.Uint64(result[:8])^t)
+			copy(buf[8:], result[i*8:i*8+8])
+			block.Decrypt(buf, buf)
+			copy(result[:8], buf[:8])
+			copy(result[i*8:], buf[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(result[:8], aesKeyWrapIV) != 1 {
+		return nil, fmt.Errorf("key unwrap: integrity check failed")
+	}
+	return result[8:], nil
+}
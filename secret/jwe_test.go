@@ -0,0 +1,214 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func getJWEKey(t *testing.T, id string) JWEKey {
+	t.Helper()
+	key, err := NewKey(AES256KeyLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return JWEKey{ID: id, Key: key}
+}
+
+// TestAESKeyWrapVectors uses test vectors from RFC 3394, section 4.
+func TestAESKeyWrapVectors(t *testing.T) {
+	cases := []struct {
+		kek, plaintext, ciphertext string
+	}{
+		{
+			"000102030405060708090A0B0C0D0E0F",
+			"00112233445566778899AABBCCDDEEFF",
+			"1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5",
+		},
+		{
+			"000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+			"00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F",
+			"28C9F404C4B810F4CBCCB35CFB87F8263F5786E2D80ED326CBC7F0E71A99F43BFB988B9B7A02DD21",
+		},
+	}
+	for _, c := range cases {
+		kek, _ := hex.DecodeString(c.kek)
+		plaintext, _ := hex.DecodeString(c.plaintext)
+		expected, _ := hex.DecodeString(c.ciphertext)
+
+		ciphertext, err := aesKeyWrap(kek, plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(expected, ciphertext) {
+			t.Fatalf("wrap:\n\texpected: %X\n\treceived: %X", expected, ciphertext)
+		}
+		unwrapped, err := aesKeyUnwrap(kek, ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plaintext, unwrapped) {
+			t.Fatalf("unwrap:\n\texpected: %X\n\treceived: %X", plaintext, unwrapped)
+		}
+		ciphertext[0] ^= 0x01
+		if _, err := aesKeyUnwrap(kek, ciphertext); err == nil {
+			t.Fatal("unwrap of tampered ciphertext unexpectedly succeeded")
+		}
+	}
+}
+
+func TestJWEEncodeDecodeJSON(t *testing.T) {
+	for _, alg := range []string{JWEDirect, JWEA256KW} {
+		auth, err := NewAuthenticatorJWE(alg, getJWEKey(t, "2022-01"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := NewStringWithAuth(auth, "the cake is a lie")
+		token, err := src.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("ciphertext (%s): %s", alg, token)
+		if n := strings.Count(string(token), "."); n != 4 {
+			t.Fatalf("expected 5 segments in compact serialization, received %d", n+1)
+		}
+		dst := NewStringWithAuth(auth, "")
+		if err := dst.UnmarshalText(token); err != nil {
+			t.Fatal(err)
+		}
+		if src.Value() != dst.Value() {
+			t.Fatalf("unequal:\n\tsrc: %s\n\tdst: %s\n", src.Value(), dst.Value())
+		}
+	}
+}
+
+func TestJWEKeyRotation(t *testing.T) {
+	oldKey, newKey := getJWEKey(t, "old"), getJWEKey(t, "new")
+	old, err := NewAuthenticatorJWE(JWEA256KW, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewAuthenticatorJWE(JWEA256KW, newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := NewAuthenticatorJWE(JWEA256KW, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := old.Encrypt([]byte(`still alive`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := current.Decrypt(token); !errors.Is(err, ErrInvalidJWE) {
+		t.Fatalf("expecting ErrInvalidJWE, received %v", err)
+	}
+	secret, err := rotated.Decrypt(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != `still alive` {
+		t.Fatalf("expected %q, received %q", `still alive`, secret)
+	}
+}
+
+// TestJWEDecryptForeign ensures tokens produced by other JOSE implementations,
+// which may serialize header differently, can be decrypted.
+func TestJWEDecryptForeign(t *testing.T) {
+	key := getJWEKey(t, "")
+	block, err := aes.NewCipher(key.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := base64.RawURLEncoding.EncodeToString([]byte(`{"enc":"A256GCM", "alg":"dir"}`))
+	iv := make([]byte, 12)
+	sealed := aead.Seal(nil, iv, []byte(`the right man in the wrong place`), []byte(protected))
+	token := strings.Join([]string{
+		protected,
+		"",
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(sealed[:len(sealed)-16]),
+		base64.RawURLEncoding.EncodeToString(sealed[len(sealed)-16:]),
+	}, ".")
+
+	auth, err := NewAuthenticatorJWE(JWEDirect, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := auth.Decrypt([]byte(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != `the right man in the wrong place` {
+		t.Fatalf("unexpected secret: %q", secret)
+	}
+
+	tampered := strings.Replace(token, protected, base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"dir","enc":"A256GCM"}`)), 1)
+	if _, err := auth.Decrypt([]byte(tampered)); !errors.Is(err, ErrInvalidJWE) {
+		t.Fatalf("expecting ErrInvalidJWE for tampered header, received %v", err)
+	}
+}
+
+func TestJWEHMACKey(t *testing.T) {
+	key := getJWEKey(t, "")
+	auth, err := NewAuthenticatorJWE(JWEDirect, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac, err := auth.HMAC([]byte("poyo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.HMACCheck([]byte("poyo"), mac); err != nil {
+		t.Fatal(err)
+	}
+	// Content encryption key is not used as HMAC key.
+	if bytes.Equal(mac, calcNonceHMAC(key.Key, mac[:hmacNonceLength], []byte("poyo"))) {
+		t.Fatal("HMAC unexpectedly uses content encryption key")
+	}
+}
+
+func TestJWEDecryptShortCEK(t *testing.T) {
+	key := getJWEKey(t, "")
+	auth, err := NewAuthenticatorJWE(JWEA256KW, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// AES-128 content encryption key, wrapped with valid key encryption key.
+	cek := make([]byte, 16)
+	encryptedKey, err := aesKeyWrap(key.Key, cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"A256KW","enc":"A256GCM"}`))
+	iv := make([]byte, 12)
+	sealed := aead.Seal(nil, iv, []byte(`poyo`), []byte(protected))
+	token := strings.Join([]string{
+		protected,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(sealed[:len(sealed)-16]),
+		base64.RawURLEncoding.EncodeToString(sealed[len(sealed)-16:]),
+	}, ".")
+	if _, err := auth.Decrypt([]byte(token)); !errors.Is(err, ErrInvalidJWE) {
+		t.Fatalf("expecting ErrInvalidJWE for 128-bit content encryption key, received %v", err)
+	}
+}
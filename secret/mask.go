@@ -0,0 +1,130 @@
+package secret
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Masking partially reveals secrets (e.g. "****1234" or "j***@example.com") for support
+// screens or logs, without exposing the plaintext through Value.
+
+// MaskRune replaces masked characters, unless configured through MaskCustom.
+const MaskRune = '*'
+
+// Masker returns masked representation of plaintext.
+type Masker func(plaintext string) string
+
+// Mask returns plaintext masked by m. Masked representation of an empty secret is empty.
+func (s Bytes) Mask(m Masker) string {
+	if len(s.secret) == 0 {
+		return ""
+	}
+	return m(string(s.secret))
+}
+
+// MaskCustom returns Masker which replaces every character with mask, except the first
+// keepFirst and the last keepLast of them. Secrets which are not longer than both are
+// masked entirely, as they would be revealed otherwise. Negative counts are treated as 0.
+func MaskCustom(mask rune, keepFirst, keepLast int) Masker {
+	if keepFirst < 0 {
+		keepFirst = 0
+	}
+	if keepLast < 0 {
+		keepLast = 0
+	}
+	return func(plaintext string) string {
+		runes := []rune(plaintext)
+		first, last := keepFirst, keepLast
+		// Compared without adding both, which may overflow.
+		if len(runes)-first <= last {
+			first, last = 0, 0
+		}
+		for i := first; i < len(runes)-last; i++ {
+			runes[i] = mask
+		}
+		return string(runes)
+	}
+}
+
+// MaskLast returns Masker which reveals the last n characters, e.g. "****1234".
+func MaskLast(n int) Masker {
+	return MaskCustom(MaskRune, 0, n)
+}
+
+// MaskEmail reveals the first character of local part and the domain of email
+// addresses, e.g. "j***@example.com". Values which are not email addresses are
+// masked entirely.
+func MaskEmail(plaintext string) string {
+	at := strings.LastIndex(plaintext, "@")
+	if at <= 0 {
+		return MaskCustom(MaskRune, 0, 0)(plaintext)
+	}
+	local := []rune(plaintext[:at])
+	return string(local[0]) + strings.Repeat(string(MaskRune), 3) + plaintext[at:]
+}
+
+// MaskPhone reveals the last 4 digits of phone numbers, as well as their formatting,
+// e.g. "+* (***) ***-0123".
+func MaskPhone(plaintext string) string {
+	runes := []rune(plaintext)
+	// Phone numbers which are too short are masked entirely, as they would be revealed otherwise.
+	if countDigits(runes) <= 4 {
+		return MaskCustom(MaskRune, 0, 0)(plaintext)
+	}
+	kept := 0
+	for i := len(runes) - 1; i >= 0; i-- {
+		if !unicode.IsDigit(runes[i]) {
+			continue
+		}
+		if kept < 4 {
+			kept++
+			continue
+		}
+		runes[i] = MaskRune
+	}
+	return string(runes)
+}
+
+func countDigits(runes []rune) int {
+	n := 0
+	for _, r := range runes {
+		if unicode.IsDigit(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// Masked is implemented by Bytes and String.
+type Masked interface {
+	Mask(m Masker) string
+}
+
+// MaskFuncs returns template functions which mask secrets, to be provided to Funcs of
+// text/template or html/template:
+//
+//	{{ .Card | maskLast 4 }}         ****1234
+//	{{ .Email | maskEmail }}         j***@example.com
+//	{{ .Phone | maskPhone }}         +* (***) ***-0123
+//	{{ .Token | mask "•" 4 4 }}      acme••••••••••5d2c
+func MaskFuncs() map[string]any {
+	return map[string]any{
+		"maskLast": func(n int, s Masked) string {
+			return s.Mask(MaskLast(n))
+		},
+		"maskEmail": func(s Masked) string {
+			return s.Mask(MaskEmail)
+		},
+		"maskPhone": func(s Masked) string {
+			return s.Mask(MaskPhone)
+		},
+		"mask": func(mask string, keepFirst, keepLast int, s Masked) string {
+			r := MaskRune
+			for _, c := range mask {
+				r = c
+				break
+			}
+			return s.Mask(MaskCustom(r, keepFirst, keepLast))
+		},
+	}
+}
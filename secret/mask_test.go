@@ -0,0 +1,92 @@
+package secret
+
+import (
+	htmltemplate "html/template"
+	"math"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestMask(t *testing.T) {
+	for _, tc := range []struct {
+		secret   string
+		masker   Masker
+		expected string
+	}{
+		{"4111111111111234", MaskLast(4), "************1234"},
+		{"1234", MaskLast(4), "****"},
+		{"", MaskLast(4), ""},
+		{"kirby@dreamland.example", MaskEmail, "k***@dreamland.example"},
+		{"ピンク@dreamland.example", MaskEmail, "ピ***@dreamland.example"},
+		{"poyo", MaskEmail, "****"},
+		{"@dreamland.example", MaskEmail, "******************"},
+		{"+1 (650) 555-0123", MaskPhone, "+* (***) ***-0123"},
+		{"6505550123", MaskPhone, "******0123"},
+		{"0123", MaskPhone, "****"},
+		{"acme_live_sNMO1k5H", MaskCustom('•', 5, 2), "acme_•••••••••••5H"},
+		{"poyo", MaskCustom('•', 2, 2), "••••"},
+		{"poyo", MaskLast(-1), "****"},
+		{"poyo", MaskCustom(MaskRune, -1, 1), "***o"},
+		{"poyo", MaskCustom(MaskRune, 1, -3), "p***"},
+		{"poyo", MaskCustom(MaskRune, math.MaxInt, math.MaxInt), "****"},
+	} {
+		if actual := NewString(tc.secret).Mask(tc.masker); actual != tc.expected {
+			t.Fatalf("%q: expecting %q, but received %q", tc.secret, tc.expected, actual)
+		}
+	}
+
+	// Maskers can be reused.
+	m := MaskCustom(MaskRune, 1, 1)
+	if a, b := NewBytes([]byte("poyo")).Mask(m), NewBytes([]byte("po")).Mask(m); a != "p**o" || b != "**" {
+		t.Fatalf("unexpected masks: %q, %q", a, b)
+	}
+	if a := NewBytes([]byte("poyo")).Mask(m); a != "p**o" {
+		t.Fatalf("unexpected mask after reuse: %q", a)
+	}
+}
+
+func TestMaskFuncs(t *testing.T) {
+	data := struct {
+		Card  String
+		Email String
+		Phone String
+		Token Bytes
+	}{
+		Card:  NewString("4111111111111234"),
+		Email: NewString("kirby@dreamland.example"),
+		Phone: NewString("+1 (650) 555-0123"),
+		Token: NewBytes([]byte("acme_live_sNMO1k5H")),
+	}
+	const text = `{{ .Card }} {{ .Card | maskLast 4 }} {{ .Email | maskEmail }} {{ .Phone | maskPhone }} {{ .Token | mask "•" 5 2 }}`
+	const expected = `[REDACTED] ************1234 k***@dreamland.example +* (***) ***-0123 acme_•••••••••••5H`
+
+	var b strings.Builder
+	tmpl := template.Must(template.New("").Funcs(MaskFuncs()).Parse(text))
+	if err := tmpl.Execute(&b, data); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != expected {
+		t.Fatalf("unexpected text/template output: %s", b.String())
+	}
+
+	b.Reset()
+	htmlTmpl := htmltemplate.Must(htmltemplate.New("").Funcs(MaskFuncs()).Parse(text))
+	if err := htmlTmpl.Execute(&b, data); err != nil {
+		t.Fatal(err)
+	}
+	// html/template escapes "+" as well.
+	if b.String() != strings.Replace(expected, "+", "&#43;", 1) {
+		t.Fatalf("unexpected html/template output: %s", b.String())
+	}
+
+	// Negative counts do not panic during execution.
+	b.Reset()
+	tmpl = template.Must(template.New("").Funcs(MaskFuncs()).Parse(`{{ .Card | maskLast -1 }} {{ .Token | mask "*" -1 0 }}`))
+	if err := tmpl.Execute(&b, data); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "**************** ******************" {
+		t.Fatalf("unexpected output for negative counts: %s", b.String())
+	}
+}
@@ -0,0 +1,305 @@
+package secret
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidOTP = errors.New("invalid one-time password")
+	ErrOTPReplay  = errors.New("one-time password has already been used")
+	// ErrInvalidOTPConfig is returned when HOTP or TOTP (e.g. deserialized from storage)
+	// has missing secret, unknown algorithm, or unsupported digits.
+	ErrInvalidOTPConfig = errors.New("invalid one-time password configuration")
+)
+
+// OTPAlgorithm is hash function of HMAC used to generate one-time passwords.
+type OTPAlgorithm string
+
+const (
+	OTPSHA1   OTPAlgorithm = "SHA1"
+	OTPSHA256 OTPAlgorithm = "SHA256"
+	OTPSHA512 OTPAlgorithm = "SHA512"
+)
+
+const (
+	// DefaultOTPDigits is the number of digits of one-time passwords, unless configured.
+	DefaultOTPDigits = 6
+	// MinOTPDigits and MaxOTPDigits bound configured digits: fewer digits are easily
+	// guessed, while more than 10 digits exceed the 31-bit truncated HMAC.
+	MinOTPDigits = 6
+	MaxOTPDigits = 10
+	// DefaultTOTPPeriod is validity period of time-based one-time passwords, unless configured.
+	DefaultTOTPPeriod = 30 * time.Second
+	// OTPSecretLength is the length of secrets generated by NewHOTP and NewTOTP, as
+	// recommended by RFC 4226.
+	OTPSecretLength = 20
+)
+
+var otpSecretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// HOTP generates and verifies counter-based one-time passwords (RFC 4226).
+//
+// Secret is Bytes, therefore it is encrypted when HOTP is marshaled (e.g. to JSON).
+// Verify advances Counter, which should be persisted along with it.
+type HOTP struct {
+	Secret    Bytes        `json:"secret"`
+	Algorithm OTPAlgorithm `json:"algorithm,omitempty"`
+	// Digits is the number of digits (between MinOTPDigits and MaxOTPDigits) of passwords,
+	// DefaultOTPDigits unless set.
+	Digits      int    `json:"digits,omitempty"`
+	Issuer      string `json:"issuer,omitempty"`
+	AccountName string `json:"account_name,omitempty"`
+	// Counter is the next counter expected by Verify.
+	Counter uint64 `json:"counter"`
+	// Window is the number of counters after Counter which are accepted by Verify,
+	// in case the client generated passwords which were not used.
+	Window int `json:"window,omitempty"`
+}
+
+// NewHOTP returns HOTP with a random secret, for account of issuer.
+func NewHOTP(issuer, accountName string) (*HOTP, error) {
+	secret, err := newOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	return &HOTP{Secret: secret, Issuer: issuer, AccountName: accountName, Window: 3}, nil
+}
+
+// Validate returns ErrInvalidOTPConfig if h cannot generate passwords.
+func (h *HOTP) Validate() error {
+	return validateOTP(h.Secret.Value(), h.Algorithm, h.Digits)
+}
+
+// Generate returns one-time password for counter, or an empty string (which is never
+// accepted) if h is invalid.
+func (h *HOTP) Generate(counter uint64) string {
+	return generateOTP(h.Secret.Value(), h.Algorithm, h.Digits, counter)
+}
+
+// Verify validates code against counters starting from Counter, up to Window counters
+// ahead. If valid, Counter is advanced past the matched counter, so that the code
+// cannot be used again.
+func (h *HOTP) Verify(code string) error {
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	for i := 0; i <= h.Window; i++ {
+		counter := h.Counter + uint64(i)
+		if equalOTP(h.Generate(counter), code) {
+			h.Counter = counter + 1
+			return nil
+		}
+	}
+	return ErrInvalidOTP
+}
+
+// URI returns otpauth:// URI for enrollment (e.g. as QR code) in authenticator apps,
+// or an empty string if h is invalid.
+func (h *HOTP) URI() string {
+	if h.Validate() != nil {
+		return ""
+	}
+	query := otpQuery(h.Secret.Value(), h.Issuer, h.Algorithm, h.Digits)
+	query.Set("counter", strconv.FormatUint(h.Counter, 10))
+	return otpURI("hotp", h.Issuer, h.AccountName, query)
+}
+
+// TOTP generates and verifies time-based one-time passwords (RFC 6238).
+//
+// Secret is Bytes, therefore it is encrypted when TOTP is marshaled (e.g. to JSON).
+// Verify updates LastCounter, which should be persisted along with it.
+type TOTP struct {
+	Secret    Bytes        `json:"secret"`
+	Algorithm OTPAlgorithm `json:"algorithm,omitempty"`
+	// Digits is the number of digits (between MinOTPDigits and MaxOTPDigits) of passwords,
+	// DefaultOTPDigits unless set.
+	Digits int `json:"digits,omitempty"`
+	// Period is validity period of passwords in seconds, DefaultTOTPPeriod unless set.
+	Period      int    `json:"period,omitempty"`
+	Issuer      string `json:"issuer,omitempty"`
+	AccountName string `json:"account_name,omitempty"`
+	// Skew is the number of periods before and after the current one which are accepted
+	// by Verify, to tolerate clock drift and delay of user input.
+	Skew int `json:"skew,omitempty"`
+	// LastCounter is the time step of the last password accepted by Verify. Passwords of
+	// the same or earlier time steps are refused, so that they cannot be used again.
+	LastCounter uint64 `json:"last_counter,omitempty"`
+}
+
+// NewTOTP returns TOTP with a random secret, for account of issuer.
+func NewTOTP(issuer, accountName string) (*TOTP, error) {
+	secret, err := newOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	return &TOTP{Secret: secret, Issuer: issuer, AccountName: accountName, Skew: 1}, nil
+}
+
+// Validate returns ErrInvalidOTPConfig if t cannot generate passwords.
+func (t *TOTP) Validate() error {
+	return validateOTP(t.Secret.Value(), t.Algorithm, t.Digits)
+}
+
+// Generate returns one-time password valid at t, or an empty string (which is never
+// accepted) if t is invalid.
+func (t *TOTP) Generate(at time.Time) string {
+	return t.generate(t.counter(at))
+}
+
+func (t *TOTP) generate(counter uint64) string {
+	return generateOTP(t.Secret.Value(), t.Algorithm, t.Digits, counter)
+}
+
+// Verify validates code at current time (see SetClock), within Skew periods.
+// If valid, LastCounter is updated, so that the code (or earlier ones) cannot be used again.
+func (t *TOTP) Verify(code string) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	current := t.counter(now())
+	for i := -t.Skew; i <= t.Skew; i++ {
+		counter := current + uint64(i)
+		if i < 0 && current < uint64(-i) {
+			continue
+		}
+		if !equalOTP(t.generate(counter), code) {
+			continue
+		}
+		if counter <= t.LastCounter {
+			return ErrOTPReplay
+		}
+		t.LastCounter = counter
+		return nil
+	}
+	return ErrInvalidOTP
+}
+
+// URI returns otpauth:// URI for enrollment (e.g. as QR code) in authenticator apps,
+// or an empty string if t is invalid.
+func (t *TOTP) URI() string {
+	if t.Validate() != nil {
+		return ""
+	}
+	query := otpQuery(t.Secret.Value(), t.Issuer, t.Algorithm, t.Digits)
+	query.Set("period", strconv.Itoa(int(t.period()/time.Second)))
+	return otpURI("totp", t.Issuer, t.AccountName, query)
+}
+
+func (t *TOTP) counter(at time.Time) uint64 {
+	return uint64(at.Unix()) / uint64(t.period()/time.Second)
+}
+
+func (t *TOTP) period() time.Duration {
+	if t.Period <= 0 {
+		return DefaultTOTPPeriod
+	}
+	return time.Duration(t.Period) * time.Second
+}
+
+func newOTPSecret() (Bytes, error) {
+	secret := make([]byte, OTPSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return Bytes{}, err
+	}
+	return NewBytes(secret), nil
+}
+
+func (a OTPAlgorithm) hash() (func() hash.Hash, error) {
+	switch a {
+	case "", OTPSHA1:
+		return sha1.New, nil
+	case OTPSHA256:
+		return sha256.New, nil
+	case OTPSHA512:
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unknown otp algorithm: %s", a)
+}
+
+func validateOTP(secret []byte, algorithm OTPAlgorithm, digits int) error {
+	if len(secret) == 0 {
+		return fmt.Errorf("%w: missing secret", ErrInvalidOTPConfig)
+	}
+	if _, err := algorithm.hash(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidOTPConfig, err)
+	}
+	if digits != 0 && (digits < MinOTPDigits || digits > MaxOTPDigits) {
+		return fmt.Errorf("%w: digits must be between %d and %d, received %d", ErrInvalidOTPConfig, MinOTPDigits, MaxOTPDigits, digits)
+	}
+	return nil
+}
+
+// generateOTP returns one-time password of secret for counter, as specified by RFC 4226.
+// Invalid configuration results in an empty password, which is never accepted.
+func generateOTP(secret []byte, algorithm OTPAlgorithm, digits int, counter uint64) string {
+	if validateOTP(secret, algorithm, digits) != nil {
+		return ""
+	}
+	h, _ := algorithm.hash()
+	if digits == 0 {
+		digits = DefaultOTPDigits
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(h, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation.
+	offset := sum[len(sum)-1] & 0xf
+	code := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+	modulo := uint64(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, code%modulo)
+}
+
+func equalOTP(expected, code string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1
+}
+
+func otpQuery(secret []byte, issuer string, algorithm OTPAlgorithm, digits int) url.Values {
+	if algorithm == "" {
+		algorithm = OTPSHA1
+	}
+	if digits == 0 {
+		digits = DefaultOTPDigits
+	}
+	query := url.Values{}
+	query.Set("secret", otpSecretEncoding.EncodeToString(secret))
+	if issuer != "" {
+		query.Set("issuer", issuer)
+	}
+	query.Set("algorithm", string(algorithm))
+	query.Set("digits", strconv.Itoa(digits))
+	return query
+}
+
+// otpURI formats otpauth:// URI as specified by Key Uri Format of Google Authenticator.
+func otpURI(kind, issuer, accountName string, query url.Values) string {
+	label := accountName
+	if issuer != "" {
+		label = issuer + ":" + accountName
+	}
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     kind,
+		Path:     "/" + label,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
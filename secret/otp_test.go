@@ -0,0 +1,200 @@
+package secret
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHOTPVectors(t *testing.T) {
+	// RFC 4226, Appendix D.
+	h := &HOTP{Secret: NewBytes([]byte("12345678901234567890"))}
+	for counter, expected := range []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	} {
+		if code := h.Generate(uint64(counter)); code != expected {
+			t.Fatalf("counter %d: expecting %s, but received %s", counter, expected, code)
+		}
+	}
+}
+
+func TestTOTPVectors(t *testing.T) {
+	// RFC 6238, Appendix B.
+	seeds := map[OTPAlgorithm]string{
+		OTPSHA1:   "12345678901234567890",
+		OTPSHA256: "12345678901234567890123456789012",
+		OTPSHA512: "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	for _, tc := range []struct {
+		unix     int64
+		expected map[OTPAlgorithm]string
+	}{
+		{59, map[OTPAlgorithm]string{OTPSHA1: "94287082", OTPSHA256: "46119246", OTPSHA512: "90693936"}},
+		{1111111109, map[OTPAlgorithm]string{OTPSHA1: "07081804", OTPSHA256: "68084774", OTPSHA512: "25091201"}},
+		{1111111111, map[OTPAlgorithm]string{OTPSHA1: "14050471", OTPSHA256: "67062674", OTPSHA512: "99943326"}},
+		{1234567890, map[OTPAlgorithm]string{OTPSHA1: "89005924", OTPSHA256: "91819424", OTPSHA512: "93441116"}},
+		{2000000000, map[OTPAlgorithm]string{OTPSHA1: "69279037", OTPSHA256: "90698825", OTPSHA512: "38618901"}},
+		{20000000000, map[OTPAlgorithm]string{OTPSHA1: "65353130", OTPSHA256: "77737706", OTPSHA512: "47863826"}},
+	} {
+		for algorithm, expected := range tc.expected {
+			totp := &TOTP{Secret: NewBytes([]byte(seeds[algorithm])), Algorithm: algorithm, Digits: 8}
+			if code := totp.Generate(time.Unix(tc.unix, 0)); code != expected {
+				t.Fatalf("%s at %d: expecting %s, but received %s", algorithm, tc.unix, expected, code)
+			}
+		}
+	}
+}
+
+func TestHOTPVerify(t *testing.T) {
+	h := &HOTP{Secret: NewBytes([]byte("12345678901234567890")), Window: 2}
+	if err := h.Verify("755224"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Verify("755224"); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("expecting ErrInvalidOTP, but received %v", err)
+	}
+	// Counters within window are accepted, skipping the ones in between.
+	if err := h.Verify("969429"); err != nil {
+		t.Fatal(err)
+	}
+	if h.Counter != 4 {
+		t.Fatalf("unexpected counter: %d", h.Counter)
+	}
+	if err := h.Verify("162583"); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("expecting ErrInvalidOTP outside of window, but received %v", err)
+	}
+}
+
+func TestTOTPVerify(t *testing.T) {
+	current := time.Unix(1111111111, 0)
+	SetClock(func() time.Time { return current })
+	defer SetClock(nil)
+
+	totp := &TOTP{Secret: NewBytes([]byte("12345678901234567890")), Skew: 1}
+	previous := totp.Generate(current.Add(-30 * time.Second))
+	if err := totp.Verify(totp.Generate(current.Add(-90 * time.Second))); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("expecting ErrInvalidOTP outside of skew, but received %v", err)
+	}
+	if err := totp.Verify(previous); err != nil {
+		t.Fatal(err)
+	}
+	if err := totp.Verify(previous); !errors.Is(err, ErrOTPReplay) {
+		t.Fatalf("expecting ErrOTPReplay, but received %v", err)
+	}
+	if err := totp.Verify(totp.Generate(current)); err != nil {
+		t.Fatal(err)
+	}
+	if err := totp.Verify("000000"); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("expecting ErrInvalidOTP, but received %v", err)
+	}
+	if err := (&TOTP{Secret: totp.Secret, Algorithm: "MD5"}).Verify(""); !errors.Is(err, ErrInvalidOTPConfig) {
+		t.Fatalf("expecting ErrInvalidOTPConfig for unknown algorithm, but received %v", err)
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	totp := &TOTP{Secret: NewBytes([]byte("12345678901234567890")), Issuer: "ACME Co", AccountName: "kirby@dreamland.example"}
+	u, err := url.Parse(totp.URI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/ACME Co:kirby@dreamland.example" {
+		t.Fatalf("unexpected uri: %s", u)
+	}
+	for k, v := range map[string]string{
+		"secret":    "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"issuer":    "ACME Co",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	} {
+		if actual := u.Query().Get(k); actual != v {
+			t.Fatalf("unexpected %s: %s", k, actual)
+		}
+	}
+
+	hotp, err := NewHOTP("ACME Co", "kirby@dreamland.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, err = url.Parse(hotp.URI()); err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "hotp" || u.Query().Get("counter") != "0" {
+		t.Fatalf("unexpected uri: %s", u)
+	}
+}
+
+func TestTOTPEncryptedAtRest(t *testing.T) {
+	totp, err := NewTOTP("ACME Co", "kirby@dreamland.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	totp.Secret = NewBytesWithAuth(getAuth(), totp.Secret.Value())
+	raw, err := json.Marshal(totp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("totp (json): %s", raw)
+
+	dst := &TOTP{Secret: NewBytesWithAuth(getAuth(), nil)}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		t.Fatal(err)
+	}
+	if code := totp.Generate(now()); dst.Generate(now()) != code {
+		t.Fatalf("unequal codes after round trip: %s", code)
+	}
+}
+
+func TestOTPValidate(t *testing.T) {
+	secret := NewBytes([]byte("12345678901234567890"))
+	for _, tc := range []struct {
+		digits int
+		valid  bool
+		length int
+	}{
+		{0, true, DefaultOTPDigits},
+		{5, false, 0},
+		{6, true, 6},
+		{10, true, 10},
+		{11, false, 0},
+		{64, false, 0},
+	} {
+		h := &HOTP{Secret: secret, Digits: tc.digits}
+		totp := &TOTP{Secret: secret, Digits: tc.digits}
+		if err := h.Validate(); (err == nil) != tc.valid {
+			t.Fatalf("%d digits: unexpected validation: %v", tc.digits, err)
+		}
+		if code := h.Generate(0); len(code) != tc.length {
+			t.Fatalf("%d digits: unexpected code: %q", tc.digits, code)
+		}
+		if code := totp.Generate(time.Unix(59, 0)); len(code) != tc.length {
+			t.Fatalf("%d digits: unexpected code: %q", tc.digits, code)
+		}
+		if tc.valid {
+			continue
+		}
+		if err := h.Verify(""); !errors.Is(err, ErrInvalidOTPConfig) {
+			t.Fatalf("%d digits: expecting ErrInvalidOTPConfig, but received %v", tc.digits, err)
+		}
+		if err := totp.Verify(""); !errors.Is(err, ErrInvalidOTPConfig) {
+			t.Fatalf("%d digits: expecting ErrInvalidOTPConfig, but received %v", tc.digits, err)
+		}
+		if u := totp.URI(); u != "" {
+			t.Fatalf("%d digits: unexpected uri: %s", tc.digits, u)
+		}
+	}
+
+	// Missing secret, or unknown algorithm.
+	for _, totp := range []*TOTP{{}, {Secret: secret, Algorithm: "MD5"}} {
+		if err := totp.Verify("755224"); !errors.Is(err, ErrInvalidOTPConfig) {
+			t.Fatalf("expecting ErrInvalidOTPConfig, but received %v", err)
+		}
+		if code := totp.Generate(time.Unix(59, 0)); code != "" {
+			t.Fatalf("unexpected code: %q", code)
+		}
+	}
+}
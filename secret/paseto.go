@@ -0,0 +1,330 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"time"
+)
+
+var (
+	ErrInvalidPaseto     = errors.New("invalid paseto")
+	ErrTokenNotYetValid  = errors.New("token not yet valid")
+	ErrPasetoFooterMatch = errors.New("paseto footer mismatch")
+)
+
+const (
+	PasetoV3LocalKeyLength = 32
+
+	pasetoV3LocalHeader  = "v3.local."
+	pasetoV3PublicHeader = "v3.public."
+
+	pasetoV3NonceLength     = 32
+	pasetoV3MACLength       = sha512.Size384
+	pasetoV3SignatureLength = 96 // r || s, 48 bytes each for P-384
+)
+
+// PasetoV3Local encrypts and decrypts v3.local PASETO tokens
+// (https://github.com/paseto-standard/paseto-spec), which use AES-256-CTR and HMAC-SHA384.
+//
+// Payloads must be JSON objects. Registered claims "exp" and "nbf", when present,
+// are validated on Decrypt.
+type PasetoV3Local struct {
+	key []byte
+	now func() time.Time
+}
+
+// NewPasetoV3Local creates v3.local token encoder/decoder from a 32-byte key.
+func NewPasetoV3Local(key []byte) (*PasetoV3Local, error) {
+	if len(key) != PasetoV3LocalKeyLength {
+		return nil, fmt.Errorf("paseto v3.local: expected %d bytes key, actual %d", PasetoV3LocalKeyLength, len(key))
+	}
+	return &PasetoV3Local{key: key, now: now}, nil
+}
+
+// Encrypt creates v3.local token of payload with optional footer (readable by anyone,
+// but authenticated) and implicit assertion (authenticated, but not included in token).
+func (p *PasetoV3Local) Encrypt(payload, footer, implicit []byte) ([]byte, error) {
+	nonce := make([]byte, pasetoV3NonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return p.encrypt(nonce, payload, footer, implicit)
+}
+
+func (p *PasetoV3Local) encrypt(nonce, payload, footer, implicit []byte) ([]byte, error) {
+	if _, err := parsePasetoClaims(payload); err != nil {
+		return nil, err
+	}
+	encKey, ctrNonce, authKey := p.deriveKeys(nonce)
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, len(payload))
+	cipher.NewCTR(block, ctrNonce).XORKeyStream(ciphertext, payload)
+
+	mac := hmac.New(sha512.New384, authKey)
+	mac.Write(pae([]byte(pasetoV3LocalHeader), nonce, ciphertext, footer, implicit))
+
+	body := make([]byte, 0, len(nonce)+len(ciphertext)+pasetoV3MACLength)
+	body = append(body, nonce...)
+	body = append(body, ciphertext...)
+	body = mac.Sum(body)
+	return encodePaseto(pasetoV3LocalHeader, body, footer), nil
+}
+
+// Decrypt validates v3.local token against footer (if provided) and implicit assertion,
+// then returns its payload. Expired tokens are rejected with ErrTokenExpired.
+func (p *PasetoV3Local) Decrypt(token, footer, implicit []byte) ([]byte, error) {
+	body, footer, err := decodePaseto(pasetoV3LocalHeader, token, footer)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < pasetoV3NonceLength+pasetoV3MACLength {
+		return nil, fmt.Errorf("%w: token is too short", ErrInvalidPaseto)
+	}
+	nonce := body[:pasetoV3NonceLength]
+	ciphertext := body[pasetoV3NonceLength : len(body)-pasetoV3MACLength]
+	tag := body[len(body)-pasetoV3MACLength:]
+
+	encKey, ctrNonce, authKey := p.deriveKeys(nonce)
+	mac := hmac.New(sha512.New384, authKey)
+	mac.Write(pae([]byte(pasetoV3LocalHeader), nonce, ciphertext, footer, implicit))
+	if !hmac.Equal(mac.Sum(nil), tag) {
+		return nil, ErrInvalidPaseto
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, ctrNonce).XORKeyStream(payload, ciphertext)
+	if err := validatePasetoClaims(payload, p.now()); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func (p *PasetoV3Local) deriveKeys(nonce []byte) (encKey, ctrNonce, authKey []byte) {
+	tmp := hkdf(sha512.New384, p.key, nil, append([]byte("paseto-encryption-key"), nonce...), 48)
+	authKey = hkdf(sha512.New384, p.key, nil, append([]byte("paseto-auth-key-for-aead"), nonce...), 48)
+	return tmp[:32], tmp[32:], authKey
+}
+
+// PasetoV3Public signs and verifies v3.public PASETO tokens
+// (https://github.com/paseto-standard/paseto-spec), which use ECDSA over P-384 with SHA-384.
+//
+// Payloads must be JSON objects. Registered claims "exp" and "nbf", when present,
+// are validated on Verify.
+type PasetoV3Public struct {
+	private *ecdsa.PrivateKey
+	public  *ecdsa.PublicKey
+	now     func() time.Time
+}
+
+// NewPasetoV3Public creates v3.public token signer and verifier from a P-384 private key.
+func NewPasetoV3Public(private *ecdsa.PrivateKey) (*PasetoV3Public, error) {
+	if private == nil || private.Curve != elliptic.P384() {
+		return nil, fmt.Errorf("paseto v3.public: expected P-384 private key")
+	}
+	return &PasetoV3Public{private: private, public: &private.PublicKey, now: now}, nil
+}
+
+// NewPasetoV3Verifier creates v3.public token verifier from a P-384 public key.
+func NewPasetoV3Verifier(public *ecdsa.PublicKey) (*PasetoV3Public, error) {
+	if public == nil || public.Curve != elliptic.P384() {
+		return nil, fmt.Errorf("paseto v3.public: expected P-384 public key")
+	}
+	return &PasetoV3Public{public: public, now: now}, nil
+}
+
+// Sign creates v3.public token of payload with optional footer and implicit assertion.
+func (p *PasetoV3Public) Sign(payload, footer, implicit []byte) ([]byte, error) {
+	if p.private == nil {
+		return nil, fmt.Errorf("paseto v3.public: private key is required to sign")
+	}
+	if _, err := parsePasetoClaims(payload); err != nil {
+		return nil, err
+	}
+	digest := sha512.Sum384(pae(p.compressedPublicKey(), []byte(pasetoV3PublicHeader), payload, footer, implicit))
+	r, s, err := ecdsa.Sign(rand.Reader, p.private, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, len(payload)+pasetoV3SignatureLength)
+	copy(body, payload)
+	r.FillBytes(body[len(payload) : len(payload)+48])
+	s.FillBytes(body[len(payload)+48:])
+	return encodePaseto(pasetoV3PublicHeader, body, footer), nil
+}
+
+// Verify validates v3.public token against footer (if provided) and implicit assertion,
+// then returns its payload. Expired tokens are rejected with ErrTokenExpired.
+func (p *PasetoV3Public) Verify(token, footer, implicit []byte) ([]byte, error) {
+	body, footer, err := decodePaseto(pasetoV3PublicHeader, token, footer)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < pasetoV3SignatureLength {
+		return nil, fmt.Errorf("%w: token is too short", ErrInvalidPaseto)
+	}
+	payload, sig := body[:len(body)-pasetoV3SignatureLength], body[len(body)-pasetoV3SignatureLength:]
+	digest := sha512.Sum384(pae(p.compressedPublicKey(), []byte(pasetoV3PublicHeader), payload, footer, implicit))
+	r, s := new(big.Int).SetBytes(sig[:48]), new(big.Int).SetBytes(sig[48:])
+	if !ecdsa.Verify(p.public, digest[:], r, s) {
+		return nil, ErrInvalidPaseto
+	}
+	if err := validatePasetoClaims(payload, p.now()); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func (p *PasetoV3Public) compressedPublicKey() []byte {
+	return elliptic.MarshalCompressed(p.public.Curve, p.public.X, p.public.Y)
+}
+
+// pasetoClaims are registered claims which are validated on decryption or verification.
+type pasetoClaims struct {
+	Expiration *time.Time `json:"exp,omitempty"`
+	NotBefore  *time.Time `json:"nbf,omitempty"`
+}
+
+// parsePasetoClaims returns registered claims of payload, which must be a JSON object,
+// so that tokens which could not be decrypted or verified are never created.
+func parsePasetoClaims(payload []byte) (*pasetoClaims, error) {
+	trimmed := bytes.TrimLeft(payload, " \t\r\n")
+	if len(trimmed) == 0 || trimmed[0] != '{' || !json.Valid(payload) {
+		return nil, fmt.Errorf("%w: payload must be JSON object", ErrInvalidPaseto)
+	}
+	claims := &pasetoClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims: %v", ErrInvalidPaseto, err)
+	}
+	return claims, nil
+}
+
+func validatePasetoClaims(payload []byte, now time.Time) error {
+	claims, err := parsePasetoClaims(payload)
+	if err != nil {
+		return err
+	}
+	if claims.Expiration != nil && !now.Before(*claims.Expiration) {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != nil && now.Before(*claims.NotBefore) {
+		return ErrTokenNotYetValid
+	}
+	return nil
+}
+
+func encodePaseto(header string, body, footer []byte) []byte {
+	token := make([]byte, 0, len(header)+base64.RawURLEncoding.EncodedLen(len(body))+1+base64.RawURLEncoding.EncodedLen(len(footer)))
+	token = append(token, header...)
+	token = append(token, encodeBase64(body)...)
+	if len(footer) > 0 {
+		token = append(token, '.')
+		token = append(token, encodeBase64(footer)...)
+	}
+	return token
+}
+
+// pasetoEncoding rejects non-canonical encodings (i.e. non-zero trailing bits), which
+// would otherwise allow altering tokens without invalidating them.
+var pasetoEncoding = base64.RawURLEncoding.Strict()
+
+// decodePaseto returns body and footer of token. If expected footer is provided,
+// footer of token must be identical, otherwise footer of token is returned as is
+// (though it is still authenticated by the caller as part of PAE).
+func decodePaseto(header string, token, expected []byte) ([]byte, []byte, error) {
+	if !bytes.HasPrefix(token, []byte(header)) {
+		return nil, nil, fmt.Errorf("%w: expected %q header", ErrInvalidPaseto, header)
+	}
+	parts := bytes.Split(token[len(header):], []byte("."))
+	if len(parts) > 2 {
+		return nil, nil, fmt.Errorf("%w: too many segments", ErrInvalidPaseto)
+	}
+	var footer []byte
+	if len(parts) == 2 {
+		var err error
+		if footer, err = pasetoEncoding.DecodeString(string(parts[1])); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPaseto, err)
+		}
+	}
+	if len(expected) > 0 && subtle.ConstantTimeCompare(footer, expected) != 1 {
+		return nil, nil, ErrPasetoFooterMatch
+	}
+	body, err := pasetoEncoding.DecodeString(string(parts[0]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPaseto, err)
+	}
+	return body, footer, nil
+}
+
+// PasetoFooter returns footer of PASETO token without validating it, e.g. to look up
+// key ID before decryption or verification.
+func PasetoFooter(token []byte) ([]byte, error) {
+	for _, header := range []string{pasetoV3LocalHeader, pasetoV3PublicHeader} {
+		if bytes.HasPrefix(token, []byte(header)) {
+			_, footer, err := decodePaseto(header, token, nil)
+			return footer, err
+		}
+	}
+	return nil, fmt.Errorf("%w: unsupported header", ErrInvalidPaseto)
+}
+
+// pae implements Pre-Authentication Encoding (PAE) as defined by PASETO spec.
+func pae(pieces ...[]byte) []byte {
+	size := 8
+	for _, piece := range pieces {
+		size += 8 + len(piece)
+	}
+	result := make([]byte, 8, size)
+	binary.LittleEndian.PutUint64(result, uint64(len(pieces))&(1<<63-1))
+	for _, piece := range pieces {
+		var length [8]byte
+		binary.LittleEndian.PutUint64(length[:], uint64(len(piece))&(1<<63-1))
+		result = append(result, length[:]...)
+		result = append(result, piece...)
+	}
+	return result
+}
+
+// hkdf implements HMAC-based Extract-and-Expand Key Derivation Function (RFC 5869).
+func hkdf(h func() hash.Hash, secret, salt, info []byte, length int) []byte {
+	if len(salt) == 0 {
+		salt = make([]byte, h().Size())
+	}
+	extractor := hmac.New(h, salt)
+	extractor.Write(secret)
+	prk := extractor.Sum(nil)
+
+	expander := hmac.New(h, prk)
+	result := make([]byte, 0, length+expander.Size())
+	var prev []byte
+	for counter := byte(1); len(result) < length; counter++ {
+		expander.Reset()
+		expander.Write(prev)
+		expander.Write(info)
+		expander.Write([]byte{counter})
+		prev = expander.Sum(nil)
+		result = append(result, prev...)
+	}
+	return result[:length]
+}
@@ -0,0 +1,268 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestPAE uses examples from PASETO spec (docs/01-Protocol-Versions/Common.md).
+func TestPAE(t *testing.T) {
+	cases := []struct {
+		pieces   [][]byte
+		expected string
+	}{
+		{nil, "0000000000000000"},
+		{[][]byte{{}}, "01000000000000000000000000000000"},
+		{[][]byte{[]byte("test")}, "0100000000000000040000000000000074657374"},
+	}
+	for _, c := range cases {
+		if actual := hex.EncodeToString(pae(c.pieces...)); actual != c.expected {
+			t.Errorf("expected %s, received %s", c.expected, actual)
+		}
+	}
+}
+
+// TestHKDF uses test vectors from RFC 5869, appendix A.1 and A.3.
+func TestHKDF(t *testing.T) {
+	cases := []struct {
+		secret, salt, info, expected string
+	}{
+		{
+			"0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b",
+			"000102030405060708090a0b0c",
+			"f0f1f2f3f4f5f6f7f8f9",
+			"3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865",
+		},
+		{
+			"0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b",
+			"",
+			"",
+			"8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8",
+		},
+	}
+	for _, c := range cases {
+		secret, _ := hex.DecodeString(c.secret)
+		salt, _ := hex.DecodeString(c.salt)
+		info, _ := hex.DecodeString(c.info)
+		if actual := hex.EncodeToString(hkdf(sha256.New, secret, salt, info, 42)); actual != c.expected {
+			t.Errorf("expected %s, received %s", c.expected, actual)
+		}
+	}
+}
+
+func TestPasetoV3Local(t *testing.T) {
+	key, err := NewKey(PasetoV3LocalKeyLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPasetoV3Local(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte(`{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`)
+	footer := []byte(`{"kid":"zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN"}`)
+	implicit := []byte(`{"test-vector":"3-S-3"}`)
+	p.now = func() time.Time { return time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC) }
+
+	token, err := p.Encrypt(payload, footer, implicit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("token: %s", token)
+
+	actual, err := p.Decrypt(token, footer, implicit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, actual) {
+		t.Fatalf("expected:\n\t%s\nreceived:\n\t%s", payload, actual)
+	}
+	if actual, err := PasetoFooter(token); err != nil || !bytes.Equal(footer, actual) {
+		t.Fatalf("unexpected footer %s (%v)", actual, err)
+	}
+
+	if _, err := p.Decrypt(token, []byte(`{"kid":"other"}`), implicit); !errors.Is(err, ErrPasetoFooterMatch) {
+		t.Fatalf("expecting ErrPasetoFooterMatch, received %v", err)
+	}
+	if _, err := p.Decrypt(token, footer, []byte(`{}`)); !errors.Is(err, ErrInvalidPaseto) {
+		t.Fatalf("expecting ErrInvalidPaseto for wrong implicit assertion, received %v", err)
+	}
+
+	p.now = func() time.Time { return time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC) }
+	if _, err := p.Decrypt(token, footer, implicit); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expecting ErrTokenExpired, received %v", err)
+	}
+}
+
+func TestPasetoPayload(t *testing.T) {
+	key, err := NewKey(PasetoV3LocalKeyLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := NewPasetoV3Local(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := NewPasetoV3Public(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Payloads which would be refused on decryption or verification are refused upfront.
+	for _, payload := range []string{"", " ", "null", "42", `"poyo"`, `["poyo"]`, `{"poyo"`, `{"exp":"tomorrow"}`} {
+		if _, err := local.Encrypt([]byte(payload), nil, nil); !errors.Is(err, ErrInvalidPaseto) {
+			t.Fatalf("%q: expecting ErrInvalidPaseto, but received %v", payload, err)
+		}
+		if _, err := public.Sign([]byte(payload), nil, nil); !errors.Is(err, ErrInvalidPaseto) {
+			t.Fatalf("%q: expecting ErrInvalidPaseto, but received %v", payload, err)
+		}
+	}
+
+	payload := []byte(" {\"data\":\"poyo\"}\n")
+	token, err := local.Encrypt(payload, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := local.Decrypt(token, nil, nil); err != nil || !bytes.Equal(payload, actual) {
+		t.Fatalf("unexpected payload %q (%v)", actual, err)
+	}
+	token, err = public.Sign(payload, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := public.Verify(token, nil, nil); err != nil || !bytes.Equal(payload, actual) {
+		t.Fatalf("unexpected payload %q (%v)", actual, err)
+	}
+}
+
+func TestPasetoV3Public(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewPasetoV3Public(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewPasetoV3Verifier(&private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte(`{"data":"this is a signed message","nbf":"2022-01-01T00:00:00+00:00"}`)
+	footer := []byte(`{"kid":"dYkISylxQeecEcHELfzF88UZrwbLolNiCdpzUHGw9Uqn"}`)
+
+	token, err := signer.Sign(payload, footer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("token: %s", token)
+
+	verifier.now = func() time.Time { return time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC) }
+	actual, err := verifier.Verify(token, footer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, actual) {
+		t.Fatalf("expected:\n\t%s\nreceived:\n\t%s", payload, actual)
+	}
+	if _, err := verifier.Verify(token, footer, []byte(`{"test-vector":"3-S-3"}`)); !errors.Is(err, ErrInvalidPaseto) {
+		t.Fatalf("expecting ErrInvalidPaseto for wrong implicit assertion, received %v", err)
+	}
+
+	verifier.now = func() time.Time { return time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC) }
+	if _, err := verifier.Verify(token, footer, nil); !errors.Is(err, ErrTokenNotYetValid) {
+		t.Fatalf("expecting ErrTokenNotYetValid, received %v", err)
+	}
+}
+
+// TestPasetoV3Vectors runs official test vectors (v3.json) from
+// https://github.com/paseto-standard/test-vectors.
+func TestPasetoV3Vectors(t *testing.T) {
+	raw, err := os.ReadFile("testdata/paseto-v3.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors := struct {
+		Tests []struct {
+			Name       string  `json:"name"`
+			ExpectFail bool    `json:"expect-fail"`
+			Key        string  `json:"key"`
+			Nonce      string  `json:"nonce"`
+			PublicKey  string  `json:"public-key"`
+			Token      string  `json:"token"`
+			Payload    *string `json:"payload"`
+			Footer     string  `json:"footer"`
+			Implicit   string  `json:"implicit-assertion"`
+		} `json:"tests"`
+	}{}
+	if err := json.Unmarshal(raw, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	// Test vectors contain claims which have expired.
+	now := func() time.Time { return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	if len(vectors.Tests) == 0 {
+		t.Fatal("no test vectors")
+	}
+	for _, v := range vectors.Tests {
+		var payload []byte
+		var err error
+		switch {
+		case v.Key != "":
+			key, _ := hex.DecodeString(v.Key)
+			p, perr := NewPasetoV3Local(key)
+			if perr != nil {
+				t.Fatalf("%s: %v", v.Name, perr)
+			}
+			p.now = now
+			if nonce, _ := hex.DecodeString(v.Nonce); !v.ExpectFail {
+				token, err := p.encrypt(nonce, []byte(*v.Payload), []byte(v.Footer), []byte(v.Implicit))
+				if err != nil || string(token) != v.Token {
+					t.Errorf("%s: expected token %s, received %s (%v)", v.Name, v.Token, token, err)
+				}
+			}
+			payload, err = p.Decrypt([]byte(v.Token), []byte(v.Footer), []byte(v.Implicit))
+		case v.PublicKey != "":
+			compressed, _ := hex.DecodeString(v.PublicKey)
+			x, y := elliptic.UnmarshalCompressed(elliptic.P384(), compressed)
+			if x == nil {
+				if !v.ExpectFail {
+					t.Errorf("%s: invalid public key", v.Name)
+				}
+				continue
+			}
+			p, perr := NewPasetoV3Verifier(&ecdsa.PublicKey{Curve: elliptic.P384(), X: x, Y: y})
+			if perr != nil {
+				t.Fatalf("%s: %v", v.Name, perr)
+			}
+			p.now = now
+			payload, err = p.Verify([]byte(v.Token), []byte(v.Footer), []byte(v.Implicit))
+		default:
+			continue
+		}
+		if v.ExpectFail {
+			if err == nil {
+				t.Errorf("%s: expected failure", v.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", v.Name, err)
+		} else if string(payload) != *v.Payload {
+			t.Errorf("%s: expected payload %s, received %s", v.Name, *v.Payload, payload)
+		}
+	}
+}
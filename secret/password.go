@@ -0,0 +1,457 @@
+package secret
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Passwords should never be decrypted, hence Password holds a one-way hash instead of
+// the encrypted secret. Hashes are encoded in PHC string format, which carries the
+// algorithm and its parameters along with the salt, e.g.
+// "$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>".
+
+var (
+	ErrPasswordMismatch    = errors.New("password does not match")
+	ErrInvalidPasswordHash = errors.New("invalid password hash")
+)
+
+// PasswordAlgorithm is key derivation function used to hash passwords.
+type PasswordAlgorithm string
+
+const (
+	PasswordArgon2id     PasswordAlgorithm = "argon2id"
+	PasswordScrypt       PasswordAlgorithm = "scrypt"
+	PasswordPBKDF2SHA256 PasswordAlgorithm = "pbkdf2-sha256"
+)
+
+// PasswordParams configures hashing of passwords. Fields which do not apply to
+// Algorithm are ignored, and zero fields are defaulted from the recommended
+// parameters of Algorithm (e.g. PasswordParamsArgon2id).
+type PasswordParams struct {
+	Algorithm PasswordAlgorithm
+	// Iterations is number of passes of Argon2id, or iterations of PBKDF2.
+	Iterations uint32
+	// Memory is memory cost of Argon2id in KiB.
+	Memory uint32
+	// Parallelism is degree of parallelism of Argon2id and scrypt.
+	Parallelism uint8
+	// LogN is log2 of CPU/memory cost of scrypt.
+	LogN uint8
+	// BlockSize is block size of scrypt.
+	BlockSize  uint32
+	SaltLength int
+	KeyLength  int
+}
+
+// Recommended parameters of each algorithm, per OWASP Password Storage Cheat Sheet.
+var (
+	PasswordParamsArgon2id = PasswordParams{
+		Algorithm:   PasswordArgon2id,
+		Iterations:  2,
+		Memory:      19 * 1024,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+	PasswordParamsScrypt = PasswordParams{
+		Algorithm:   PasswordScrypt,
+		LogN:        17,
+		BlockSize:   8,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+	PasswordParamsPBKDF2SHA256 = PasswordParams{
+		Algorithm:  PasswordPBKDF2SHA256,
+		Iterations: 600_000,
+		SaltLength: 16,
+		KeyLength:  32,
+	}
+)
+
+// PasswordLimits bounds costs of hashes accepted by Verify and UnmarshalText, so that
+// hashes from untrusted sources (e.g. a tampered database row) cannot exhaust memory
+// or CPU. Zero fields are defaulted from DefaultPasswordLimits.
+type PasswordLimits struct {
+	// MaxMemory is maximum memory cost in KiB, of Argon2id as well as scrypt.
+	MaxMemory uint32
+	// MaxArgon2Iterations is maximum number of passes of Argon2id.
+	MaxArgon2Iterations uint32
+	// MaxPBKDF2Iterations is maximum number of iterations of PBKDF2.
+	MaxPBKDF2Iterations uint32
+	// MaxLogN is maximum log2 of CPU/memory cost of scrypt.
+	MaxLogN uint8
+	// MaxBlockSize is maximum block size of scrypt.
+	MaxBlockSize uint32
+	// MaxKeyLength is maximum length of derived keys.
+	MaxKeyLength int
+	// MaxParallelism is maximum degree of parallelism of Argon2id and scrypt.
+	MaxParallelism uint8
+}
+
+// DefaultPasswordLimits allows well above the recommended parameters of each algorithm.
+var DefaultPasswordLimits = PasswordLimits{
+	MaxMemory:           1024 * 1024,
+	MaxArgon2Iterations: 16,
+	MaxPBKDF2Iterations: 10_000_000,
+	MaxLogN:             20,
+	MaxBlockSize:        32,
+	MaxKeyLength:        128,
+	MaxParallelism:      8,
+}
+
+var (
+	passwordParams = PasswordParamsArgon2id
+	passwordLimits = DefaultPasswordLimits
+)
+
+// SetPasswordParams configures parameters used by Password to hash passwords, which
+// is PasswordParamsArgon2id by default. Existing hashes with other parameters are
+// still accepted by Verify, but reported by NeedsRehash.
+func SetPasswordParams(params PasswordParams) error {
+	params, err := params.withDefaults()
+	if err != nil {
+		return err
+	}
+	if err := params.within(passwordLimits); err != nil {
+		return err
+	}
+	passwordParams = params
+	return nil
+}
+
+// SetPasswordLimits configures limits of hashes accepted by Verify and UnmarshalText,
+// which is DefaultPasswordLimits by default. Parameters configured by SetPasswordParams
+// must be within the limits.
+func SetPasswordLimits(limits PasswordLimits) error {
+	limits = limits.withDefaults()
+	if err := passwordParams.within(limits); err != nil {
+		return err
+	}
+	passwordLimits = limits
+	return nil
+}
+
+// Password holds hash of a password, which is hashed on Set. Only the hash is
+// marshaled (e.g. to JSON or database), and the password cannot be recovered from it.
+type Password struct {
+	hash string
+}
+
+// NewPassword returns Password with hash of password, using parameters configured by
+// SetPasswordParams.
+func NewPassword(password string) (Password, error) {
+	return NewPasswordWithParams(password, passwordParams)
+}
+
+// NewPasswordWithParams returns Password with hash of password, using params.
+func NewPasswordWithParams(password string, params PasswordParams) (Password, error) {
+	params, err := params.withDefaults()
+	if err != nil {
+		return Password{}, err
+	}
+	if err := params.within(passwordLimits); err != nil {
+		return Password{}, err
+	}
+	salt, err := NewKey(params.SaltLength)
+	if err != nil {
+		return Password{}, err
+	}
+	key, err := params.derive([]byte(password), salt)
+	if err != nil {
+		return Password{}, err
+	}
+	return Password{hash: params.encode(salt, key)}, nil
+}
+
+// Set replaces hash with the one of password, using parameters configured by
+// SetPasswordParams.
+func (p *Password) Set(password string) error {
+	hashed, err := NewPassword(password)
+	if err != nil {
+		return err
+	}
+	*p = hashed
+	return nil
+}
+
+// Verify returns nil if password matches the hash, otherwise ErrPasswordMismatch.
+// Hashes are compared in constant time.
+func (p Password) Verify(password string) error {
+	params, salt, key, err := parsePasswordHash(p.hash)
+	if err != nil {
+		return ErrPasswordMismatch
+	}
+	derived, err := params.derive([]byte(password), salt)
+	if err != nil || subtle.ConstantTimeCompare(derived, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+// NeedsRehash reports whether the hash was made with parameters other than the ones
+// configured by SetPasswordParams. Such passwords should be hashed again (see Set)
+// once verified, e.g. at login.
+func (p Password) NeedsRehash() bool {
+	params, _, _, err := parsePasswordHash(p.hash)
+	return err != nil || params != passwordParams
+}
+
+// IsZero reports whether the password has not been set.
+func (p Password) IsZero() bool {
+	return p.hash == ""
+}
+
+// Hash returns the encoded hash.
+func (p Password) Hash() string {
+	return p.hash
+}
+
+// String returns the encoded hash, which is safe to be printed.
+func (p Password) String() string {
+	return p.hash
+}
+
+// MarshalText outputs the encoded hash.
+func (p Password) MarshalText() ([]byte, error) {
+	return []byte(p.hash), nil
+}
+
+// UnmarshalText reads encoded hash, as opposed to a password to be hashed.
+func (p *Password) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*p = Password{}
+		return nil
+	}
+	if _, _, _, err := parsePasswordHash(string(text)); err != nil {
+		return err
+	}
+	p.hash = string(text)
+	return nil
+}
+
+// Value implements driver.Valuer, storing the encoded hash, or NULL if not set.
+func (p Password) Value() (driver.Value, error) {
+	if p.hash == "" {
+		return nil, nil
+	}
+	return p.hash, nil
+}
+
+// Scan implements sql.Scanner, reading the encoded hash.
+func (p *Password) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*p = Password{}
+		return nil
+	case string:
+		return p.UnmarshalText([]byte(v))
+	case []byte:
+		return p.UnmarshalText(v)
+	}
+	return fmt.Errorf("unable to scan %T into Password", src)
+}
+
+func (params PasswordParams) withDefaults() (PasswordParams, error) {
+	var defaults PasswordParams
+	switch params.Algorithm {
+	case PasswordArgon2id:
+		defaults = PasswordParamsArgon2id
+	case PasswordScrypt:
+		defaults = PasswordParamsScrypt
+	case PasswordPBKDF2SHA256:
+		defaults = PasswordParamsPBKDF2SHA256
+	default:
+		return params, fmt.Errorf("unknown password algorithm: %q", params.Algorithm)
+	}
+	if params.Iterations == 0 {
+		params.Iterations = defaults.Iterations
+	}
+	if params.Memory == 0 {
+		params.Memory = defaults.Memory
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = defaults.Parallelism
+	}
+	if params.LogN == 0 {
+		params.LogN = defaults.LogN
+	}
+	if params.BlockSize == 0 {
+		params.BlockSize = defaults.BlockSize
+	}
+	if params.SaltLength <= 0 {
+		params.SaltLength = defaults.SaltLength
+	}
+	if params.KeyLength <= 0 {
+		params.KeyLength = defaults.KeyLength
+	}
+	// Parameters which do not apply are cleared, so that they can be compared.
+	switch params.Algorithm {
+	case PasswordArgon2id:
+		params.LogN, params.BlockSize = 0, 0
+	case PasswordScrypt:
+		params.Iterations, params.Memory = 0, 0
+	case PasswordPBKDF2SHA256:
+		params.Memory, params.Parallelism, params.LogN, params.BlockSize = 0, 0, 0, 0
+	}
+	return params, nil
+}
+
+// within returns error if params exceeds limits.
+func (params PasswordParams) within(limits PasswordLimits) error {
+	switch {
+	case params.Algorithm == PasswordArgon2id && params.Memory > limits.MaxMemory:
+		return fmt.Errorf("argon2id memory %d KiB exceeds limit of %d KiB", params.Memory, limits.MaxMemory)
+	case params.Algorithm == PasswordArgon2id && params.Iterations > limits.MaxArgon2Iterations:
+		return fmt.Errorf("argon2id iterations %d exceeds limit of %d", params.Iterations, limits.MaxArgon2Iterations)
+	case params.Algorithm == PasswordPBKDF2SHA256 && params.Iterations > limits.MaxPBKDF2Iterations:
+		return fmt.Errorf("pbkdf2 iterations %d exceeds limit of %d", params.Iterations, limits.MaxPBKDF2Iterations)
+	case params.Algorithm == PasswordScrypt && params.LogN > limits.MaxLogN:
+		return fmt.Errorf("scrypt cost %d exceeds limit of %d", params.LogN, limits.MaxLogN)
+	case params.Algorithm == PasswordScrypt && params.BlockSize > limits.MaxBlockSize:
+		return fmt.Errorf("scrypt block size %d exceeds limit of %d", params.BlockSize, limits.MaxBlockSize)
+	case params.Algorithm != PasswordPBKDF2SHA256 && params.Parallelism > limits.MaxParallelism:
+		return fmt.Errorf("%s parallelism %d exceeds limit of %d", params.Algorithm, params.Parallelism, limits.MaxParallelism)
+	// scrypt uses 128 * r * N bytes of memory, which is filled p times in sequence.
+	case params.Algorithm == PasswordScrypt && uint64(params.Parallelism)*uint64(params.BlockSize)<<params.LogN/8 > uint64(limits.MaxMemory):
+		return fmt.Errorf("scrypt cost %d KiB (memory times parallelism) exceeds limit of %d KiB", uint64(params.Parallelism)*uint64(params.BlockSize)<<params.LogN/8, limits.MaxMemory)
+	case params.KeyLength > limits.MaxKeyLength:
+		return fmt.Errorf("key length %d exceeds limit of %d", params.KeyLength, limits.MaxKeyLength)
+	}
+	return nil
+}
+
+func (limits PasswordLimits) withDefaults() PasswordLimits {
+	if limits.MaxMemory == 0 {
+		limits.MaxMemory = DefaultPasswordLimits.MaxMemory
+	}
+	if limits.MaxArgon2Iterations == 0 {
+		limits.MaxArgon2Iterations = DefaultPasswordLimits.MaxArgon2Iterations
+	}
+	if limits.MaxPBKDF2Iterations == 0 {
+		limits.MaxPBKDF2Iterations = DefaultPasswordLimits.MaxPBKDF2Iterations
+	}
+	if limits.MaxLogN == 0 {
+		limits.MaxLogN = DefaultPasswordLimits.MaxLogN
+	}
+	if limits.MaxBlockSize == 0 {
+		limits.MaxBlockSize = DefaultPasswordLimits.MaxBlockSize
+	}
+	if limits.MaxKeyLength <= 0 {
+		limits.MaxKeyLength = DefaultPasswordLimits.MaxKeyLength
+	}
+	if limits.MaxParallelism == 0 {
+		limits.MaxParallelism = DefaultPasswordLimits.MaxParallelism
+	}
+	return limits
+}
+
+func (params PasswordParams) derive(password, salt []byte) ([]byte, error) {
+	switch params.Algorithm {
+	case PasswordArgon2id:
+		return argon2.IDKey(password, salt, params.Iterations, params.Memory, params.Parallelism, uint32(params.KeyLength)), nil
+	case PasswordScrypt:
+		return scrypt.Key(password, salt, 1<<params.LogN, int(params.BlockSize), int(params.Parallelism), params.KeyLength)
+	case PasswordPBKDF2SHA256:
+		return pbkdf2.Key(password, salt, int(params.Iterations), params.KeyLength, sha256.New), nil
+	}
+	return nil, fmt.Errorf("unknown password algorithm: %q", params.Algorithm)
+}
+
+// encode formats hash in PHC string format.
+func (params PasswordParams) encode(salt, key []byte) string {
+	var settings string
+	switch params.Algorithm {
+	case PasswordArgon2id:
+		settings = fmt.Sprintf("v=%d$m=%d,t=%d,p=%d", argon2.Version, params.Memory, params.Iterations, params.Parallelism)
+	case PasswordScrypt:
+		settings = fmt.Sprintf("ln=%d,r=%d,p=%d", params.LogN, params.BlockSize, params.Parallelism)
+	case PasswordPBKDF2SHA256:
+		settings = fmt.Sprintf("i=%d", params.Iterations)
+	}
+	return strings.Join([]string{
+		"",
+		string(params.Algorithm),
+		settings,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$")
+}
+
+// parsePasswordHash parses hash in PHC string format, as formatted by encode.
+func parsePasswordHash(hash string) (params PasswordParams, salt, key []byte, err error) {
+	fields := strings.Split(hash, "$")
+	if len(fields) < 5 || fields[0] != "" {
+		return params, nil, nil, ErrInvalidPasswordHash
+	}
+	params.Algorithm = PasswordAlgorithm(fields[1])
+	settings := fields[2 : len(fields)-2]
+	if params.Algorithm == PasswordArgon2id {
+		if len(settings) != 2 || settings[0] != "v="+strconv.Itoa(argon2.Version) {
+			return params, nil, nil, fmt.Errorf("%w: unsupported argon2 version", ErrInvalidPasswordHash)
+		}
+		settings = settings[1:]
+	}
+	if len(settings) != 1 {
+		return params, nil, nil, ErrInvalidPasswordHash
+	}
+	for _, setting := range strings.Split(settings[0], ",") {
+		k, v, ok := strings.Cut(setting, "=")
+		if !ok {
+			return params, nil, nil, fmt.Errorf("%w: malformed parameter %q", ErrInvalidPasswordHash, setting)
+		}
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || n == 0 {
+			return params, nil, nil, fmt.Errorf("%w: malformed parameter %q", ErrInvalidPasswordHash, setting)
+		}
+		switch k {
+		case "m":
+			params.Memory = uint32(n)
+		case "t", "i":
+			params.Iterations = uint32(n)
+		case "p":
+			if n > 255 {
+				return params, nil, nil, fmt.Errorf("%w: parallelism out of range", ErrInvalidPasswordHash)
+			}
+			params.Parallelism = uint8(n)
+		case "ln":
+			if n > 31 {
+				return params, nil, nil, fmt.Errorf("%w: cost out of range", ErrInvalidPasswordHash)
+			}
+			params.LogN = uint8(n)
+		case "r":
+			params.BlockSize = uint32(n)
+		default:
+			return params, nil, nil, fmt.Errorf("%w: unknown parameter %q", ErrInvalidPasswordHash, k)
+		}
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(fields[len(fields)-2]); err != nil || len(salt) == 0 {
+		return params, nil, nil, fmt.Errorf("%w: malformed salt", ErrInvalidPasswordHash)
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(fields[len(fields)-1]); err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("%w: malformed hash", ErrInvalidPasswordHash)
+	}
+	params.SaltLength, params.KeyLength = len(salt), len(key)
+	if params, err = params.withDefaults(); err != nil {
+		return params, nil, nil, fmt.Errorf("%w: %v", ErrInvalidPasswordHash, err)
+	}
+	if err := params.within(passwordLimits); err != nil {
+		return params, nil, nil, fmt.Errorf("%w: %v", ErrInvalidPasswordHash, err)
+	}
+	// Hashes missing parameters, or with parameters of other algorithms, are refused
+	// rather than defaulted.
+	if params.encode(salt, key) != hash {
+		return params, nil, nil, fmt.Errorf("%w: non-canonical parameters", ErrInvalidPasswordHash)
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,210 @@
+package secret
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Parameters cheap enough for tests.
+var (
+	testPasswordArgon2id = PasswordParams{Algorithm: PasswordArgon2id, Iterations: 1, Memory: 64}
+	testPasswordScrypt   = PasswordParams{Algorithm: PasswordScrypt, LogN: 4}
+	testPasswordPBKDF2   = PasswordParams{Algorithm: PasswordPBKDF2SHA256, Iterations: 16}
+)
+
+func TestPassword(t *testing.T) {
+	for _, params := range []PasswordParams{testPasswordArgon2id, testPasswordScrypt, testPasswordPBKDF2} {
+		t.Run(string(params.Algorithm), func(t *testing.T) {
+			p, err := NewPasswordWithParams("poyo", params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Logf("hash: %s", p)
+			if !strings.HasPrefix(p.Hash(), "$"+string(params.Algorithm)+"$") {
+				t.Fatalf("unexpected hash: %s", p)
+			}
+			if err := p.Verify("poyo"); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Verify("poyo!"); !errors.Is(err, ErrPasswordMismatch) {
+				t.Fatalf("expecting ErrPasswordMismatch, but received %v", err)
+			}
+
+			// Salt is random, therefore hashes of the same password differ.
+			other, err := NewPasswordWithParams("poyo", params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if other.Hash() == p.Hash() {
+				t.Fatal("hashes of the same password are unexpectedly equal")
+			}
+		})
+	}
+}
+
+func TestPasswordScryptVector(t *testing.T) {
+	// RFC 7914, Section 12.
+	key, _ := hex.DecodeString("fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640")
+	hash := "$scrypt$ln=10,r=8,p=16$" + base64.RawStdEncoding.EncodeToString([]byte("NaCl")) + "$" + base64.RawStdEncoding.EncodeToString(key)
+	// Parallelism of the vector exceeds DefaultPasswordLimits.
+	var p Password
+	if err := p.UnmarshalText([]byte(hash)); !errors.Is(err, ErrInvalidPasswordHash) {
+		t.Fatalf("expecting ErrInvalidPasswordHash, but received %v", err)
+	}
+	defer SetPasswordLimits(DefaultPasswordLimits)
+	if err := SetPasswordLimits(PasswordLimits{MaxParallelism: 16}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.UnmarshalText([]byte(hash)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Verify("password"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPasswordMarshal(t *testing.T) {
+	type user struct {
+		Name     string   `json:"name"`
+		Password Password `json:"password"`
+	}
+	u := user{Name: "kirby"}
+	if err := u.Password.Set("poyo"); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "poyo") || !strings.Contains(string(raw), `"password":"$argon2id$v=19$m=19456,t=2,p=1$`) {
+		t.Fatalf("unexpected json: %s", raw)
+	}
+
+	var dst user
+	if err := json.Unmarshal(raw, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Password.Verify("poyo"); err != nil {
+		t.Fatal(err)
+	}
+	// Unmarshaling reads hashes, not passwords.
+	if err := json.Unmarshal([]byte(`{"password":"poyo"}`), &dst); !errors.Is(err, ErrInvalidPasswordHash) {
+		t.Fatalf("expecting ErrInvalidPasswordHash, but received %v", err)
+	}
+
+	value, err := u.Password.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scanned Password
+	if err := scanned.Scan([]byte(value.(string))); err != nil {
+		t.Fatal(err)
+	}
+	if scanned != u.Password {
+		t.Fatalf("unexpected scanned password: %s", scanned)
+	}
+	if err := scanned.Scan(nil); err != nil || !scanned.IsZero() {
+		t.Fatalf("unexpected scanned password: %s (%v)", scanned, err)
+	}
+	if value, err := scanned.Value(); value != nil || err != nil {
+		t.Fatalf("unexpected value of empty password: %v (%v)", value, err)
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	defer SetPasswordParams(PasswordParamsArgon2id)
+	if err := SetPasswordParams(testPasswordPBKDF2); err != nil {
+		t.Fatal(err)
+	}
+
+	var p Password
+	if err := p.Set("poyo"); err != nil {
+		t.Fatal(err)
+	}
+	if p.NeedsRehash() {
+		t.Fatalf("%s unexpectedly needs rehash", p)
+	}
+	for _, params := range []PasswordParams{
+		{Algorithm: PasswordPBKDF2SHA256, Iterations: 32},
+		{Algorithm: PasswordPBKDF2SHA256, Iterations: 16, KeyLength: 64},
+		testPasswordScrypt,
+	} {
+		if err := SetPasswordParams(params); err != nil {
+			t.Fatal(err)
+		}
+		if !p.NeedsRehash() {
+			t.Fatalf("%s unexpectedly does not need rehash with %+v", p, params)
+		}
+		// Outdated hashes are still accepted.
+		if err := p.Verify("poyo"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := SetPasswordParams(PasswordParams{Algorithm: "bcrypt"}); err == nil {
+		t.Fatal("unknown algorithm was unexpectedly accepted")
+	}
+}
+
+func TestPasswordLimits(t *testing.T) {
+	defer SetPasswordLimits(DefaultPasswordLimits)
+
+	p, err := NewPasswordWithParams("poyo", PasswordParams{Algorithm: PasswordPBKDF2SHA256, Iterations: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetPasswordLimits(PasswordLimits{MaxPBKDF2Iterations: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Verify("poyo"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("expecting ErrPasswordMismatch, but received %v", err)
+	}
+	if err := (&Password{}).UnmarshalText([]byte(p.Hash())); !errors.Is(err, ErrInvalidPasswordHash) {
+		t.Fatalf("expecting ErrInvalidPasswordHash, but received %v", err)
+	}
+	if _, err := NewPasswordWithParams("poyo", PasswordParams{Algorithm: PasswordPBKDF2SHA256, Iterations: 1000}); err == nil {
+		t.Fatal("parameters exceeding limits were unexpectedly accepted")
+	}
+	// Limits must allow parameters configured by SetPasswordParams.
+	if err := SetPasswordLimits(PasswordLimits{MaxMemory: 1024}); err == nil {
+		t.Fatal("limits below password parameters were unexpectedly accepted")
+	}
+}
+
+func TestPasswordInvalidHash(t *testing.T) {
+	salt := base64.RawStdEncoding.EncodeToString([]byte("saltsalt"))
+	for _, hash := range []string{
+		"poyo",
+		"$bcrypt$i=1$" + salt + "$" + salt,
+		"$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + salt,
+		"$argon2id$v=19$m=64,t=1$" + salt + "$" + salt,
+		"$argon2id$v=19$t=1,m=64,p=1$" + salt + "$" + salt,
+		"$scrypt$ln=4,r=8,p=1,i=1$" + salt + "$" + salt,
+		"$pbkdf2-sha256$i=0$" + salt + "$" + salt,
+		"$pbkdf2-sha256$i=16$" + salt + "$",
+		"$pbkdf2-sha256$i=16$!$" + salt,
+		// Costs exceeding DefaultPasswordLimits.
+		"$argon2id$v=19$m=4294967295,t=1,p=1$" + salt + "$" + salt,
+		"$argon2id$v=19$m=64,t=4294967295,p=1$" + salt + "$" + salt,
+		"$scrypt$ln=31,r=8,p=1$" + salt + "$" + salt,
+		"$scrypt$ln=4,r=4294967295,p=1$" + salt + "$" + salt,
+		"$scrypt$ln=20,r=16,p=1$" + salt + "$" + salt,
+		"$scrypt$ln=4,r=8,p=255$" + salt + "$" + salt,
+		"$scrypt$ln=20,r=8,p=2$" + salt + "$" + salt,
+		"$argon2id$v=19$m=64,t=1,p=255$" + salt + "$" + salt,
+		"$pbkdf2-sha256$i=4294967295$" + salt + "$" + salt,
+		"$pbkdf2-sha256$i=16$" + salt + "$" + base64.RawStdEncoding.EncodeToString(make([]byte, 4096)),
+	} {
+		var p Password
+		if err := p.UnmarshalText([]byte(hash)); !errors.Is(err, ErrInvalidPasswordHash) {
+			t.Fatalf("%s: expecting ErrInvalidPasswordHash, but received %v", hash, err)
+		}
+		if err := (Password{hash: hash}).Verify(""); !errors.Is(err, ErrPasswordMismatch) {
+			t.Fatalf("%s: expecting ErrPasswordMismatch, but received %v", hash, err)
+		}
+	}
+}
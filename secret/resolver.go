@@ -0,0 +1,472 @@
+package secret
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	ErrUnknownTenant = errors.New("unknown tenant")
+)
+
+var globalResolver Resolver
+
+// Resolver looks up the authenticator which belongs to a tenant, allowing
+// multi-tenant applications to encrypt secrets of each tenant with its own key.
+type Resolver interface {
+	AuthenticatorFor(ctx context.Context, tenantID string) (Authenticator, error)
+}
+
+// ResolverFunc is an adapter to allow the use of ordinary functions as Resolver.
+type ResolverFunc func(ctx context.Context, tenantID string) (Authenticator, error)
+
+func (f ResolverFunc) AuthenticatorFor(ctx context.Context, tenantID string) (Authenticator, error) {
+	return f(ctx, tenantID)
+}
+
+// MapResolver is a Resolver backed by a static map of tenant ID to authenticator.
+type MapResolver map[string]Authenticator
+
+func (m MapResolver) AuthenticatorFor(_ context.Context, tenantID string) (Authenticator, error) {
+	auth, ok := m[tenantID]
+	if !ok || auth == nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTenant, tenantID)
+	}
+	return auth, nil
+}
+
+// SetGlobalResolver configures the resolver used to look up authenticators
+// for tenants attached to context by WithTenant.
+func SetGlobalResolver(r Resolver) {
+	globalResolver = r
+}
+
+type contextKey int
+
+const (
+	tenantContextKey contextKey = iota
+	authenticatorContextKey
+)
+
+// WithTenant returns a copy of ctx which carries tenantID. Context-aware functions
+// will use the global resolver to find the authenticator of that tenant.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantContextKey, tenantID)
+}
+
+// TenantFromContext returns tenant ID attached to ctx by WithTenant, if any.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantContextKey).(string)
+	return tenantID, ok
+}
+
+// WithAuthenticator returns a copy of ctx which carries a, taking precedence over
+// any tenant attached to ctx.
+func WithAuthenticator(ctx context.Context, a Authenticator) context.Context {
+	return context.WithValue(ctx, authenticatorContextKey, a)
+}
+
+// AuthenticatorFromContext returns the authenticator for ctx. In order of precedence:
+// authenticator attached by WithAuthenticator, authenticator of tenant attached by
+// WithTenant (through resolver configured by SetGlobalResolver), then globalAuth,
+// configured by SetGlobal.
+func AuthenticatorFromContext(ctx context.Context) (Authenticator, error) {
+	if auth, ok := ctx.Value(authenticatorContextKey).(Authenticator); ok && auth != nil {
+		return auth, nil
+	}
+	if tenantID, ok := TenantFromContext(ctx); ok {
+		if globalResolver == nil {
+			return nil, fmt.Errorf("unable to resolve tenant %q: global resolver is not set (use SetGlobalResolver)", tenantID)
+		}
+		return globalResolver.AuthenticatorFor(ctx, tenantID)
+	}
+	if globalAuth == nil {
+		return nil, fmt.Errorf("missing authenticator: initialize authenticator or use SetGlobal")
+	}
+	return globalAuth, nil
+}
+
+// EncryptContext is similar to Encrypt, except the authenticator is resolved from ctx.
+func EncryptContext(ctx context.Context, secret []byte) ([]byte, error) {
+	auth, err := AuthenticatorFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encrypt: %w", err)
+	}
+	return auth.Encrypt(secret)
+}
+
+// EncryptBase64Context is similar to EncryptBase64, except the authenticator is resolved from ctx.
+func EncryptBase64Context(ctx context.Context, secret []byte) ([]byte, error) {
+	auth, err := AuthenticatorFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encrypt: %w", err)
+	}
+	return encryptBase64(auth, secret)
+}
+
+// DecryptContext is similar to Decrypt, except the authenticator is resolved from ctx.
+func DecryptContext(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	auth, err := AuthenticatorFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt: %w", err)
+	}
+	return auth.Decrypt(ciphertext)
+}
+
+// DecryptBase64Context is similar to DecryptBase64, except the authenticator is resolved from ctx.
+func DecryptBase64Context(ctx context.Context, b64 []byte) ([]byte, error) {
+	auth, err := AuthenticatorFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt: %w", err)
+	}
+	return decryptBase64(auth, b64)
+}
+
+// HMACContext is similar to HMAC, except the authenticator is resolved from ctx.
+func HMACContext(ctx context.Context, msg []byte) ([]byte, error) {
+	auth, err := AuthenticatorFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to calculate HMAC: %w", err)
+	}
+	return auth.HMAC(msg)
+}
+
+// HMACCheckContext is similar to HMACCheck, except the authenticator is resolved from ctx.
+func HMACCheckContext(ctx context.Context, msg, expected []byte) error {
+	auth, err := AuthenticatorFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to calculate HMAC: %w", err)
+	}
+	return auth.HMACCheck(msg, expected)
+}
+
+// Bind attaches the authenticator resolved from ctx to every Bytes and String
+// reachable from v, which must be a non-nil pointer. Secret values which already
+// have an authenticator attached are left untouched.
+func Bind(ctx context.Context, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("unable to bind: expected non-nil pointer, received %T", v)
+	}
+	auth, err := AuthenticatorFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to bind: %w", err)
+	}
+	bind(rv, auth, map[uintptr]bool{})
+	return nil
+}
+
+// EncodeJSON is similar to json.Marshal, except secret values in v without an
+// attached authenticator are encrypted by the authenticator resolved from ctx.
+// Secret values are bound on a copy of v, which is left untouched.
+func EncodeJSON(ctx context.Context, v any) ([]byte, error) {
+	auth, err := AuthenticatorFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode: %w", err)
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return json.Marshal(v)
+	}
+	return json.Marshal(bindCopy(rv, auth, map[uintptr]reflect.Value{}).Interface())
+}
+
+// DecodeJSON is similar to json.Unmarshal, except secret values in v without an
+// attached authenticator are decrypted by the authenticator resolved from ctx,
+// including those created while decoding (e.g. elements of slices or maps).
+//
+// Values implementing json.Unmarshaler or encoding.TextUnmarshaler (other than secret
+// values) decode themselves, therefore secret values they create cannot be bound,
+// and are refused if ctx carries a tenant or an authenticator.
+func DecodeJSON(ctx context.Context, data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("unable to decode: expected non-nil pointer, received %T", v)
+	}
+	auth, err := AuthenticatorFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to decode: %w", err)
+	}
+	// Syntax errors are reported before v is modified, as json.Unmarshal does.
+	if !json.Valid(data) {
+		return json.Unmarshal(data, v)
+	}
+	bind(rv, auth, map[uintptr]bool{})
+	_, hasTenant := TenantFromContext(ctx)
+	strict := hasTenant || ctx.Value(authenticatorContextKey) != nil
+	return decodeJSON(data, rv.Elem(), auth, strict)
+}
+
+// TextMarshalerContext is implemented by Bytes, String, DeterministicBytes, and
+// DeterministicString.
+type TextMarshalerContext interface {
+	MarshalTextContext(ctx context.Context) ([]byte, error)
+}
+
+// TextUnmarshalerContext is implemented by pointers to Bytes, String, DeterministicBytes,
+// and DeterministicString.
+type TextUnmarshalerContext interface {
+	UnmarshalTextContext(ctx context.Context, text []byte) error
+}
+
+// SQLValue returns driver.Valuer which stores s as text (see MarshalTextContext), to be
+// used as argument of database/sql queries, e.g. db.ExecContext(ctx, query,
+// secret.SQLValue(ctx, apiKey)). Secret values cannot implement driver.Valuer
+// themselves, as their Value returns the plaintext, and Value takes no context.
+func SQLValue(ctx context.Context, s TextMarshalerContext) driver.Valuer {
+	return sqlValuer{ctx: ctx, s: s}
+}
+
+// SQLScanner returns sql.Scanner which reads text (see UnmarshalTextContext) into s, to
+// be used as destination of database/sql results, e.g. row.Scan(secret.SQLScanner(ctx,
+// &apiKey)). NULL is refused, similar to scanning into string.
+func SQLScanner(ctx context.Context, s TextUnmarshalerContext) sql.Scanner {
+	return sqlScanner{ctx: ctx, s: s}
+}
+
+type sqlValuer struct {
+	ctx context.Context
+	s   TextMarshalerContext
+}
+
+func (v sqlValuer) Value() (driver.Value, error) {
+	text, err := v.s.MarshalTextContext(v.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return string(text), nil
+}
+
+type sqlScanner struct {
+	ctx context.Context
+	s   TextUnmarshalerContext
+}
+
+func (d sqlScanner) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		return d.s.UnmarshalTextContext(d.ctx, []byte(v))
+	case []byte:
+		return d.s.UnmarshalTextContext(d.ctx, v)
+	}
+	return fmt.Errorf("unable to scan %T into %T", src, d.s)
+}
+
+var (
+	bytesType              = reflect.TypeOf(Bytes{})
+	deterministicBytesType = reflect.TypeOf(DeterministicBytes{})
+)
+
+func bind(v reflect.Value, auth Authenticator, seen map[uintptr]bool) {
+	if !mayContainBytes(v.Type(), map[reflect.Type]bool{}) {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		bind(v.Elem(), auth, seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		elem := v.Elem()
+		if elem.Kind() == reflect.Pointer {
+			bind(elem, auth, seen)
+			return
+		}
+		if !v.CanSet() {
+			return
+		}
+		cp := reflect.New(elem.Type()).Elem()
+		cp.Set(elem)
+		bind(cp, auth, seen)
+		v.Set(cp)
+	case reflect.Struct:
+		// Deterministic secrets only use their own authenticators.
+		if v.Type() == deterministicBytesType {
+			return
+		}
+		if v.Type() == bytesType {
+			if !v.CanAddr() {
+				return
+			}
+			b := v.Addr().Interface().(*Bytes)
+			if b.authenticator == nil {
+				b.authenticator = auth
+			}
+			return
+		}
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if t.Field(i).IsExported() {
+				bind(v.Field(i), auth, seen)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			bind(v.Index(i), auth, seen)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			cp := reflect.New(iter.Value().Type()).Elem()
+			cp.Set(iter.Value())
+			bind(cp, auth, seen)
+			v.SetMapIndex(iter.Key(), cp)
+		}
+	}
+}
+
+// bindCopy is similar to bind, except v is copied wherever secret values are reachable,
+// rather than modified in place.
+func bindCopy(v reflect.Value, auth Authenticator, copies map[uintptr]reflect.Value) reflect.Value {
+	if !mayContainBytes(v.Type(), map[reflect.Type]bool{}) {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		if cp, ok := copies[v.Pointer()]; ok {
+			return cp
+		}
+		cp := reflect.New(v.Type().Elem())
+		copies[v.Pointer()] = cp
+		cp.Elem().Set(bindCopy(v.Elem(), auth, copies))
+		return cp
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(bindCopy(v.Elem(), auth, copies))
+		return cp
+	case reflect.Struct:
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v)
+		// Deterministic secrets only use their own authenticators.
+		if v.Type() == deterministicBytesType {
+			return cp
+		}
+		if v.Type() == bytesType {
+			b := cp.Addr().Interface().(*Bytes)
+			if b.authenticator == nil {
+				b.authenticator = auth
+			}
+			return cp
+		}
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if t.Field(i).IsExported() {
+				cp.Field(i).Set(bindCopy(v.Field(i), auth, copies))
+			}
+		}
+		return cp
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(bindCopy(v.Index(i), auth, copies))
+		}
+		return cp
+	case reflect.Array:
+		cp := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(bindCopy(v.Index(i), auth, copies))
+		}
+		return cp
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			cp.SetMapIndex(iter.Key(), bindCopy(iter.Value(), auth, copies))
+		}
+		return cp
+	}
+	return v
+}
+
+// unbound reports whether v holds non-empty secret values without an authenticator,
+// i.e. which have been decrypted by globalAuth.
+func unbound(v reflect.Value, seen map[uintptr]bool) bool {
+	if !mayContainBytes(v.Type(), map[reflect.Type]bool{}) {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || seen[v.Pointer()] {
+			return false
+		}
+		seen[v.Pointer()] = true
+		return unbound(v.Elem(), seen)
+	case reflect.Interface:
+		return !v.IsNil() && unbound(v.Elem(), seen)
+	case reflect.Struct:
+		if v.Type() == deterministicBytesType {
+			return false
+		}
+		if v.Type() == bytesType {
+			b := v.Interface().(Bytes)
+			return b.authenticator == nil && len(b.secret) > 0
+		}
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if t.Field(i).IsExported() && unbound(v.Field(i), seen) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if unbound(v.Index(i), seen) {
+				return true
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if unbound(iter.Value(), seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mayContainBytes reports whether values of t could hold Bytes, to avoid walking
+// (and copying map entries of) values which never contain secrets.
+func mayContainBytes(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if t == bytesType {
+		return true
+	}
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return mayContainBytes(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() && mayContainBytes(t.Field(i).Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
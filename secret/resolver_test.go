@@ -0,0 +1,311 @@
+package secret
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func getTenantResolver(t *testing.T) MapResolver {
+	t.Helper()
+	resolver := MapResolver{}
+	for _, tenantID := range []string{"acme", "initech"} {
+		key, err := NewKey(AES256KeyLength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth, err := NewAuthenticatorAESGCM(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resolver[tenantID] = auth
+	}
+	return resolver
+}
+
+func TestTenantEncodeDecodeJSON(t *testing.T) {
+	SetGlobalResolver(getTenantResolver(t))
+	defer SetGlobalResolver(nil)
+
+	type fakeClientConfig struct {
+		ClientID, ClientSecret String
+		Tokens                 []String
+	}
+
+	src := &fakeClientConfig{
+		ClientID:     NewString("this-is-client-id"),
+		ClientSecret: NewString("this-is-client-secret"),
+		Tokens:       []String{NewString("this-is-token")},
+	}
+
+	acme := WithTenant(context.Background(), "acme")
+	raw, err := EncodeJSON(acme, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("ciphertext (json object): %s", raw)
+
+	dst := &fakeClientConfig{Tokens: make([]String, 1)}
+	if err := DecodeJSON(acme, raw, dst); err != nil {
+		t.Fatal(err)
+	}
+	if src.ClientSecret.Value() != dst.ClientSecret.Value() {
+		t.Fatalf("unequal:\n\tsrc: %+v\n\tdst: %+v\n", src.ClientSecret.Value(), dst.ClientSecret.Value())
+	}
+	if src.Tokens[0].Value() != dst.Tokens[0].Value() {
+		t.Fatalf("unequal:\n\tsrc: %+v\n\tdst: %+v\n", src.Tokens[0].Value(), dst.Tokens[0].Value())
+	}
+
+	initech := WithTenant(context.Background(), "initech")
+	if err := DecodeJSON(initech, raw, &fakeClientConfig{}); err == nil {
+		t.Fatal("decoding with key of another tenant unexpectedly succeeded")
+	}
+}
+
+func TestTenantEncodeJSONLeavesValueUntouched(t *testing.T) {
+	SetGlobalResolver(getTenantResolver(t))
+	defer SetGlobalResolver(nil)
+
+	type fakeClientConfig struct {
+		Tokens  []String
+		Secrets map[string]*String
+	}
+	token := NewString("this-is-token")
+	src := &fakeClientConfig{
+		Tokens:  []String{NewString("this-is-token")},
+		Secrets: map[string]*String{"token": &token},
+	}
+
+	acme := WithTenant(context.Background(), "acme")
+	if _, err := EncodeJSON(acme, src); err != nil {
+		t.Fatal(err)
+	}
+	if src.Tokens[0].authenticator != nil || src.Secrets["token"].authenticator != nil {
+		t.Fatal("encoding bound authenticator of acme to the value")
+	}
+
+	// Encoding for another tenant must not reuse the key of acme.
+	initech := WithTenant(context.Background(), "initech")
+	raw, err := EncodeJSON(initech, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := &fakeClientConfig{}
+	if err := DecodeJSON(initech, raw, dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Tokens[0].Value() != "this-is-token" || dst.Secrets["token"].Value() != "this-is-token" {
+		t.Fatalf("unexpected values: %+v", dst)
+	}
+}
+
+func TestTenantDecodeJSONCreatedValues(t *testing.T) {
+	SetGlobalResolver(getTenantResolver(t))
+	defer SetGlobalResolver(nil)
+	SetGlobal(getAuth())
+	defer SetGlobal(nil)
+
+	type Embedded struct {
+		Note String `json:"note"`
+	}
+	type fakeClientConfig struct {
+		*Embedded
+		Tokens   []String             `json:"tokens"`
+		Secrets  map[string]String    `json:"secrets"`
+		Indexed  map[int]*String      `json:"indexed"`
+		Pointer  *Bytes               `json:"pointer"`
+		Nested   []map[string]*String `json:"nested"`
+		Count    int                  `json:"count,string"`
+		Ignored  String               `json:"-"`
+		Untagged String
+	}
+	src := fakeClientConfig{
+		Embedded: &Embedded{Note: NewString("note")},
+		Tokens:   []String{NewString("a"), NewString("b")},
+		Secrets:  map[string]String{"c": NewString("c")},
+		Indexed:  map[int]*String{4: func() *String { s := NewString("d"); return &s }()},
+		Pointer:  func() *Bytes { b := NewBytes([]byte("e")); return &b }(),
+		Nested:   []map[string]*String{{"f": func() *String { s := NewString("f"); return &s }()}},
+		Count:    7,
+		Ignored:  NewString("ignored"),
+		Untagged: NewString("g"),
+	}
+
+	acme := WithTenant(context.Background(), "acme")
+	raw, err := EncodeJSON(acme, &src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keys of struct fields are matched case-insensitively, as json.Unmarshal does.
+	raw = []byte(strings.Replace(string(raw), `"Untagged"`, `"untagged"`, 1))
+
+	// Secret values created while decoding are decrypted by the key of acme, rather
+	// than the global key.
+	var dst fakeClientConfig
+	if err := DecodeJSON(acme, raw, &dst); err != nil {
+		t.Fatal(err)
+	}
+	actual := []string{
+		dst.Note.Value(), dst.Tokens[0].Value(), dst.Tokens[1].Value(), dst.Secrets["c"].Value(),
+		dst.Indexed[4].Value(), string(dst.Pointer.Value()), dst.Nested[0]["f"].Value(), dst.Untagged.Value(),
+	}
+	if strings.Join(actual, "") != "noteabcdefg" || dst.Count != 7 || dst.Ignored.Value() != "" {
+		t.Fatalf("unexpected values: %q, %d, %q", actual, dst.Count, dst.Ignored.Value())
+	}
+	if dst.Secrets["c"].authenticator == nil || dst.Nested[0]["f"].authenticator == nil {
+		t.Fatal("created secret values are not bound")
+	}
+
+	// Ciphertexts of the global key must not be accepted for a tenant.
+	raw, err = json.Marshal(&fakeClientConfig{Tokens: []String{NewString("this-is-token")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DecodeJSON(acme, raw, &fakeClientConfig{}); err == nil {
+		t.Fatal("secret value of global key was unexpectedly accepted")
+	}
+	if err := DecodeJSON(context.Background(), raw, &fakeClientConfig{}); err != nil {
+		t.Fatalf("decoding without tenant failed: %v", err)
+	}
+
+	// Syntax errors are reported before the destination is modified.
+	dst = fakeClientConfig{Count: 1}
+	if err := DecodeJSON(acme, []byte(`{"count":"2",`), &dst); err == nil || dst.Count != 1 {
+		t.Fatalf("unexpected result of invalid JSON: %v, %d", err, dst.Count)
+	}
+}
+
+// secretsUnmarshaler decodes itself, creating secret values which cannot be bound.
+type secretsUnmarshaler struct {
+	Tokens []String
+}
+
+func (s *secretsUnmarshaler) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &s.Tokens)
+}
+
+func TestTenantDecodeJSONRefusesUnboundValues(t *testing.T) {
+	SetGlobalResolver(getTenantResolver(t))
+	defer SetGlobalResolver(nil)
+	SetGlobal(getAuth())
+	defer SetGlobal(nil)
+
+	raw, err := json.Marshal([]String{NewString("this-is-token")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme := WithTenant(context.Background(), "acme")
+	if err := DecodeJSON(acme, raw, &secretsUnmarshaler{}); err == nil {
+		t.Fatal("secret value decrypted by global key was unexpectedly accepted")
+	}
+	if err := DecodeJSON(context.Background(), raw, &secretsUnmarshaler{}); err != nil {
+		t.Fatalf("decoding without tenant failed: %v", err)
+	}
+}
+
+func TestUnknownTenant(t *testing.T) {
+	SetGlobalResolver(getTenantResolver(t))
+	defer SetGlobalResolver(nil)
+
+	ctx := WithTenant(context.Background(), "hooli")
+	_, err := EncryptContext(ctx, []byte(`gavin belson`))
+	if !errors.Is(err, ErrUnknownTenant) {
+		t.Fatalf("expecting ErrUnknownTenant, but received %v", err)
+	}
+}
+
+func TestContextAuthenticatorPrecedence(t *testing.T) {
+	SetGlobalResolver(getTenantResolver(t))
+	defer SetGlobalResolver(nil)
+
+	auth := getAuth()
+	ctx := WithAuthenticator(WithTenant(context.Background(), "acme"), auth)
+
+	src := NewString("never gonna give you up")
+	ciphertext, err := src.MarshalTextContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := NewStringWithAuth(auth, "")
+	if err := dst.UnmarshalText(ciphertext); err != nil {
+		t.Fatal(err)
+	}
+	if src.Value() != dst.Value() {
+		t.Fatalf("unequal:\n\tsrc: %s\n\tdst: %s\n", src.Value(), dst.Value())
+	}
+}
+
+type decodeJSONFirst struct {
+	Name   string
+	Shared int `json:"shared"`
+	Clash  int
+}
+
+type decodeJSONSecond struct {
+	Clash int
+	Level int
+}
+
+// TestDecodeJSONMatchesUnmarshal ensures fields are resolved as json.Unmarshal does.
+func TestDecodeJSONMatchesUnmarshal(t *testing.T) {
+	type decoded struct {
+		decodeJSONFirst
+		*decodeJSONSecond
+		Shared  string `json:"SHARED"`
+		Level   []int
+		Options map[string]any
+		Secret  String `json:"-"`
+	}
+	raw := []byte(`{"name":"kirby","shared":1,"SHARED":"2","Clash":3,"level":[4,5],"Options":{"a":[1,"b"]},"Level":[6],"unknown":7}`)
+	var expected, actual decoded
+	if err := json.Unmarshal(raw, &expected); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecodeJSON(WithAuthenticator(context.Background(), getAuth()), raw, &actual); err != nil {
+		t.Fatal(err)
+	}
+	// Authenticator is bound to secret values, regardless of JSON.
+	actual.Secret = String{}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expecting %+v, but received %+v", expected, actual)
+	}
+}
+
+func TestTenantSQL(t *testing.T) {
+	SetGlobalResolver(getTenantResolver(t))
+	defer SetGlobalResolver(nil)
+
+	acme := WithTenant(context.Background(), "acme")
+	src := NewString("this-is-token")
+	value, err := SQLValue(acme, src).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, ok := value.(string)
+	if !ok || strings.Contains(text, "this-is-token") {
+		t.Fatalf("unexpected value: %#v", value)
+	}
+	if !driver.IsValue(value) {
+		t.Fatalf("%T is not a valid driver value", value)
+	}
+
+	// Drivers may return text columns as []byte.
+	var dst String
+	if err := SQLScanner(acme, &dst).Scan([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Value() != "this-is-token" {
+		t.Fatalf("unexpected value: %q", dst.Value())
+	}
+	initech := WithTenant(context.Background(), "initech")
+	if err := SQLScanner(initech, &String{}).Scan(text); err == nil {
+		t.Fatal("decrypting with key of another tenant unexpectedly succeeded")
+	}
+	if err := SQLScanner(acme, &String{}).Scan(nil); err == nil {
+		t.Fatal("NULL was unexpectedly scanned")
+	}
+}
@@ -1,26 +1,31 @@
 package secret
 
 import (
-	"fmt"
+	"context"
+	"time"
 )
 
 type Bytes struct {
-	authenticator *Authenticator
+	authenticator Authenticator
 	secret        []byte
+	expiresAt     time.Time
+	ttl           time.Duration
+	encoding      Encoding
 }
 
 func NewBytes(secret []byte) Bytes {
 	return Bytes{secret: secret}
 }
 
-func NewBytesWithAuth(authenticator *Authenticator, secret []byte) Bytes {
+func NewBytesWithAuth(authenticator Authenticator, secret []byte) Bytes {
 	return Bytes{
 		authenticator: authenticator,
 		secret:        secret,
 	}
 }
 
-// MarshalText outputs base64 (URL variant) representation of encrypted secret.
+// MarshalText outputs base64 (URL variant) representation of encrypted secret, unless
+// another Encoding is configured on the value or its authenticator (see WithEncoding).
 // MarshalJSON was deliberately not added because json.Marshal relies on MarshalText
 // for JSON keys.
 // RawURLEncoding needs to be used to ensure that results are not padded, otherwise
@@ -28,67 +33,94 @@ func NewBytesWithAuth(authenticator *Authenticator, secret []byte) Bytes {
 // MarshalText will use the attached authenticator if provided, otherwise will
 // fallback to globalAuth, configured by SetGlobal
 func (s Bytes) MarshalText() ([]byte, error) {
-	auth := globalAuth
-	if s.authenticator != nil {
-		auth = s.authenticator
+	return s.MarshalTextContext(context.Background())
+}
+
+// MarshalTextContext is similar to MarshalText, except it will fallback to the
+// authenticator resolved from ctx (see AuthenticatorFromContext).
+func (s Bytes) MarshalTextContext(ctx context.Context) ([]byte, error) {
+	auth, err := s.resolve(ctx)
+	if err != nil {
+		return nil, err
 	}
-	if auth == nil {
-		return nil, fmt.Errorf("missing authenticator: initialize authenticator or use SetGlobal")
+	encoding := s.textEncoding(auth)
+	if s.ExpiresAt().IsZero() {
+		if aa, ok := auth.(AppendAuthenticator); ok {
+			return encryptTextAppend(aa, nil, s.secret, encoding)
+		}
+		if encoding == 0 {
+			return encryptBase64(auth, s.secret)
+		}
 	}
-	ciphertext, err := auth.EncryptBase64(s.secret)
+	ciphertext, err := s.encrypt(auth)
 	if err != nil {
 		return nil, err
 	}
-	return ciphertext, nil
+	return encoding.Encode(ciphertext), nil
 }
 
 // UnmarshalText will use the attached authenticator if provided, otherwise will
 // fallback to globalAuth, configured by SetGlobal
 func (s *Bytes) UnmarshalText(b64 []byte) error {
-	auth := globalAuth
-	if s.authenticator != nil {
-		auth = s.authenticator
-	}
-	if auth == nil {
-		return fmt.Errorf("missing authenticator: initialize authenticator or use SetGlobal")
-	}
-	secret, err := auth.DecryptBase64(b64)
+	return s.UnmarshalTextContext(context.Background(), b64)
+}
+
+// UnmarshalTextContext is similar to UnmarshalText, except it will fallback to the
+// authenticator resolved from ctx (see AuthenticatorFromContext).
+// Every supported Encoding is recognized, regardless of the configured one.
+func (s *Bytes) UnmarshalTextContext(ctx context.Context, text []byte) error {
+	auth, err := s.resolve(ctx)
 	if err != nil {
 		return err
 	}
-	s.secret = secret
-	return nil
+	// Authenticators with their own text representation (e.g. Fernet tokens) are
+	// attempted first, unless the ciphertext may carry expiry.
+	var textErr error
+	if _, ok := auth.(ExpiringAuthenticator); !ok {
+		if ba, ok := auth.(Base64Authenticator); ok {
+			secret, err := ba.DecryptBase64(text)
+			if err == nil {
+				s.secret = secret
+				return nil
+			}
+			textErr = err
+		}
+	}
+	err = decodeText(text, s.textEncoding(auth), func(ciphertext []byte) error {
+		return s.decrypt(auth, ciphertext)
+	})
+	if err != nil && textErr != nil {
+		return textErr
+	}
+	return err
 }
 
 func (s Bytes) MarshalBinary() ([]byte, error) {
-	auth := globalAuth
-	if s.authenticator != nil {
-		auth = s.authenticator
-	}
-	if auth == nil {
-		return nil, fmt.Errorf("missing authenticator: initialize authenticator or use SetGlobal")
-	}
-	ciphertext, err := auth.Encrypt(s.secret)
+	return s.MarshalBinaryContext(context.Background())
+}
+
+// MarshalBinaryContext is similar to MarshalBinary, except it will fallback to the
+// authenticator resolved from ctx (see AuthenticatorFromContext).
+func (s Bytes) MarshalBinaryContext(ctx context.Context) ([]byte, error) {
+	auth, err := s.resolve(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return ciphertext, nil
+	return s.encrypt(auth)
 }
 
 func (s *Bytes) UnmarshalBinary(b []byte) error {
-	auth := globalAuth
-	if s.authenticator != nil {
-		auth = s.authenticator
-	}
-	if auth == nil {
-		return fmt.Errorf("missing authenticator: initialize authenticator or use SetGlobal")
-	}
-	secret, err := auth.Decrypt(b)
+	return s.UnmarshalBinaryContext(context.Background(), b)
+}
+
+// UnmarshalBinaryContext is similar to UnmarshalBinary, except it will fallback to the
+// authenticator resolved from ctx (see AuthenticatorFromContext).
+func (s *Bytes) UnmarshalBinaryContext(ctx context.Context, b []byte) error {
+	auth, err := s.resolve(ctx)
 	if err != nil {
 		return err
 	}
-	s.secret = secret
-	return nil
+	return s.decrypt(auth, b)
 }
 
 func (s Bytes) SetValue(b []byte) {
@@ -99,6 +131,15 @@ func (s Bytes) Value() []byte {
 	return s.secret
 }
 
+// resolve returns the attached authenticator if provided, otherwise the one
+// resolved from ctx.
+func (s Bytes) resolve(ctx context.Context) (Authenticator, error) {
+	if s.authenticator != nil {
+		return s.authenticator, nil
+	}
+	return AuthenticatorFromContext(ctx)
+}
+
 type String struct {
 	Bytes
 }
@@ -109,7 +150,7 @@ func NewString(secret string) String {
 	}
 }
 
-func NewStringWithAuth(authenticator *Authenticator, secret string) String {
+func NewStringWithAuth(authenticator Authenticator, secret string) String {
 	return String{
 		Bytes: NewBytesWithAuth(authenticator, []byte(secret)),
 	}
@@ -119,3 +119,49 @@ func TestStructWithStringEncodeDecodeJSONGlobalAuth(t *testing.T) {
 	}
 	SetGlobal(nil)
 }
+
+// reverseAuth is a deterministic Authenticator to ensure alternative backends
+// can be used by Bytes and String.
+type reverseAuth struct{}
+
+func (reverseAuth) Encrypt(secret []byte) ([]byte, error) {
+	ciphertext := make([]byte, len(secret))
+	for i, b := range secret {
+		ciphertext[len(secret)-1-i] = b
+	}
+	return ciphertext, nil
+}
+
+func (r reverseAuth) Decrypt(ciphertext []byte) ([]byte, error) {
+	return r.Encrypt(ciphertext)
+}
+
+func (reverseAuth) HMAC(msg []byte) ([]byte, error) {
+	return msg, nil
+}
+
+func (reverseAuth) HMACCheck(msg, expected []byte) error {
+	if !bytes.Equal(msg, expected) {
+		return ErrHMACMismatch
+	}
+	return nil
+}
+
+func TestStringEncodeDecodeJSONCustomAuthenticator(t *testing.T) {
+	src := NewStringWithAuth(reverseAuth{}, "kirby")
+	raw, err := json.Marshal(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// base64.RawURLEncoding of "ybrik"
+	if expected := `"eWJyaWs"`; string(raw) != expected {
+		t.Fatalf("expected %s, received %s", expected, raw)
+	}
+	dst := NewStringWithAuth(reverseAuth{}, "")
+	if err := json.Unmarshal(raw, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if src.Value() != dst.Value() {
+		t.Fatalf("unequal:\n\tsrc: %s\n\tdst: %s\n", src.Value(), dst.Value())
+	}
+}
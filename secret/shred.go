@@ -0,0 +1,378 @@
+package secret
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Crypto-shredding encrypts secrets of each subject (e.g. user) with its own data key,
+// so that every secret of the subject, including copies in backups, becomes
+// unrecoverable once the key is destroyed. Data keys are wrapped (encrypted) by a
+// master key, and only the wrapped keys are stored.
+//
+// Backups of SubjectKeyStore itself would retain shredded keys, therefore it should
+// be excluded from backups, or backed up with short retention.
+
+var (
+	ErrKeyShredded        = errors.New("key has been shredded")
+	ErrSubjectKeyNotFound = errors.New("subject key not found")
+	ErrSubjectKeyConflict = errors.New("subject key already exists")
+)
+
+// SubjectKeyStore persists wrapped data keys of subjects.
+type SubjectKeyStore interface {
+	// Get returns wrapped key of subject, ErrKeyShredded if it has been shredded, or
+	// ErrSubjectKeyNotFound if it has never been created.
+	Get(ctx context.Context, subjectID string) ([]byte, error)
+	// Put adds wrapped key of subject, or returns ErrSubjectKeyConflict if it exists,
+	// or ErrKeyShredded if it has been shredded.
+	Put(ctx context.Context, subjectID string, wrapped []byte) error
+	// Shred destroys wrapped key of subject, remembering that it has been shredded.
+	Shred(ctx context.Context, subjectID string) error
+}
+
+var _ Resolver = (*SubjectKeyManager)(nil)
+
+// SubjectKeyManager creates, looks up, and shreds data keys of subjects. It implements
+// Resolver, where subjects are tenants, therefore secrets can be encrypted with keys
+// of subjects through WithTenant (see SetGlobalResolver).
+//
+// By default, authenticators of subjects look up their data keys in the store on every
+// use, trading a round trip (and unwrapping) per secret for shredding that takes effect
+// immediately, including for secrets bound to them (e.g. by DecodeJSON) and in other
+// processes sharing the store. WithSubjectKeyCache relaxes the latter.
+type SubjectKeyManager struct {
+	master Authenticator
+	store  SubjectKeyStore
+
+	cacheTTL  time.Duration
+	cacheSize int
+
+	mu         sync.Mutex
+	cache      map[string]subjectKeyCacheEntry
+	generation uint64 // incremented on every Shred
+}
+
+type subjectKeyCacheEntry struct {
+	auth      *AESGCM
+	expiresAt time.Time
+}
+
+// SubjectKeyOption configures optional behavior of SubjectKeyManager.
+type SubjectKeyOption func(*SubjectKeyManager) error
+
+// WithSubjectKeyCache caches unwrapped data keys of up to size subjects for ttl, so that
+// repeated uses of a subject do not look up its key in the store. Shred evicts the key
+// from cache of its manager immediately, while other managers sharing the store (e.g.
+// in other processes) keep using their cached key for at most ttl.
+func WithSubjectKeyCache(ttl time.Duration, size int) SubjectKeyOption {
+	return func(m *SubjectKeyManager) error {
+		if ttl <= 0 || size <= 0 {
+			return fmt.Errorf("subject key cache requires positive ttl and size: %s, %d", ttl, size)
+		}
+		m.cacheTTL = ttl
+		m.cacheSize = size
+		m.cache = make(map[string]subjectKeyCacheEntry, size)
+		return nil
+	}
+}
+
+// NewSubjectKeyManager returns SubjectKeyManager whose data keys are wrapped by master
+// and stored in store. If master implements AdditionalDataAuthenticator (e.g. AESGCM),
+// wrapped keys are bound to their subjects, so that they cannot be swapped.
+func NewSubjectKeyManager(master Authenticator, store SubjectKeyStore, opts ...SubjectKeyOption) (*SubjectKeyManager, error) {
+	if master == nil || store == nil {
+		return nil, fmt.Errorf("subject key manager requires master authenticator and store")
+	}
+	m := &SubjectKeyManager{master: master, store: store}
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// AuthenticatorFor returns authenticator of subject. Data key of the subject is created
+// on its first encryption (or MAC), while decryption (or MAC check) of a subject without
+// key fails with ErrSubjectKeyNotFound, so that reads never create keys. Shredded
+// subjects are refused with ErrKeyShredded, for encryption as well as decryption.
+//
+// The authenticator looks up the key with ctx, therefore secrets bound to it (e.g. by
+// DecodeJSON) should not be used once ctx is done.
+func (m *SubjectKeyManager) AuthenticatorFor(ctx context.Context, subjectID string) (Authenticator, error) {
+	if subjectID == "" {
+		return nil, fmt.Errorf("subject id is required")
+	}
+	if _, err := m.lookup(ctx, subjectID); err != nil && !errors.Is(err, ErrSubjectKeyNotFound) {
+		return nil, err
+	}
+	return &subjectAuthenticator{manager: m, ctx: ctx, subjectID: subjectID}, nil
+}
+
+// Create creates data key of subject, returning authenticator of the unwrapped key,
+// which remains usable after shredding (see AuthenticatorFor otherwise). If the key has been
+// created concurrently, authenticator of the existing key is returned.
+func (m *SubjectKeyManager) Create(ctx context.Context, subjectID string) (Authenticator, error) {
+	return m.create(ctx, subjectID)
+}
+
+func (m *SubjectKeyManager) create(ctx context.Context, subjectID string) (*AESGCM, error) {
+	if subjectID == "" {
+		return nil, fmt.Errorf("subject id is required")
+	}
+	key, err := NewKey(AES256KeyLength)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := m.wrap(subjectID, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.store.Put(ctx, subjectID, wrapped); err != nil {
+		if errors.Is(err, ErrSubjectKeyConflict) {
+			return m.lookup(ctx, subjectID)
+		}
+		return nil, err
+	}
+	return NewAuthenticatorAESGCM(key)
+}
+
+// Lookup returns authenticator of existing data key of subject, ErrKeyShredded if it
+// has been shredded, or ErrSubjectKeyNotFound if it has never been created. Similar to
+// Create, the authenticator remains usable after shredding.
+func (m *SubjectKeyManager) Lookup(ctx context.Context, subjectID string) (Authenticator, error) {
+	return m.lookup(ctx, subjectID)
+}
+
+func (m *SubjectKeyManager) lookup(ctx context.Context, subjectID string) (*AESGCM, error) {
+	auth, generation, ok := m.cached(subjectID)
+	if ok {
+		return auth, nil
+	}
+	wrapped, err := m.store.Get(ctx, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	key, err := m.unwrap(subjectID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unwrap key of subject %q: %w", subjectID, err)
+	}
+	auth, err = NewAuthenticatorAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	m.remember(subjectID, auth, generation)
+	return auth, nil
+}
+
+// cached returns cached authenticator of subject, and the current generation, which
+// remember requires to be unchanged.
+func (m *SubjectKeyManager) cached(subjectID string) (*AESGCM, uint64, bool) {
+	if m.cache == nil {
+		return nil, 0, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.cache[subjectID]
+	if !ok || !now().Before(entry.expiresAt) {
+		return nil, m.generation, false
+	}
+	return entry.auth, m.generation, true
+}
+
+// remember caches authenticator of subject, unless a subject has been shredded since
+// generation, as the key may have been looked up before shredding.
+func (m *SubjectKeyManager) remember(subjectID string, auth *AESGCM, generation uint64) {
+	if m.cache == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if generation != m.generation {
+		return
+	}
+	current := now()
+	if _, ok := m.cache[subjectID]; !ok && len(m.cache) >= m.cacheSize {
+		for id, entry := range m.cache {
+			if !current.Before(entry.expiresAt) {
+				delete(m.cache, id)
+			}
+		}
+		// Otherwise, evict an arbitrary subject.
+		for id := range m.cache {
+			if len(m.cache) < m.cacheSize {
+				break
+			}
+			delete(m.cache, id)
+		}
+	}
+	m.cache[subjectID] = subjectKeyCacheEntry{auth: auth, expiresAt: current.Add(m.cacheTTL)}
+}
+
+// Shred destroys data key of subject, after which none of its secrets can be decrypted.
+func (m *SubjectKeyManager) Shred(ctx context.Context, subjectID string) error {
+	err := m.store.Shred(ctx, subjectID)
+	if m.cache != nil {
+		// Evicted after shredding, as lookups in progress may cache the key until then.
+		m.mu.Lock()
+		delete(m.cache, subjectID)
+		m.generation++
+		m.mu.Unlock()
+	}
+	return err
+}
+
+func (m *SubjectKeyManager) wrap(subjectID string, key []byte) ([]byte, error) {
+	if aa, ok := m.master.(AdditionalDataAuthenticator); ok {
+		return aa.EncryptWithAdditionalData(key, subjectKeyAdditionalData(subjectID))
+	}
+	return m.master.Encrypt(key)
+}
+
+func (m *SubjectKeyManager) unwrap(subjectID string, wrapped []byte) ([]byte, error) {
+	if aa, ok := m.master.(AdditionalDataAuthenticator); ok {
+		return aa.DecryptWithAdditionalData(wrapped, subjectKeyAdditionalData(subjectID))
+	}
+	return m.master.Decrypt(wrapped)
+}
+
+// subjectAuthenticator looks up data key of subject with ctx on every use, creating it
+// on encryption unless it exists.
+type subjectAuthenticator struct {
+	manager   *SubjectKeyManager
+	ctx       context.Context
+	subjectID string
+}
+
+var (
+	_ AdditionalDataAuthenticator = (*subjectAuthenticator)(nil)
+	_ HMACWriterAuthenticator     = (*subjectAuthenticator)(nil)
+)
+
+func (a *subjectAuthenticator) auth() (*AESGCM, error) {
+	return a.manager.lookup(a.ctx, a.subjectID)
+}
+
+func (a *subjectAuthenticator) authOrCreate() (*AESGCM, error) {
+	auth, err := a.manager.lookup(a.ctx, a.subjectID)
+	if errors.Is(err, ErrSubjectKeyNotFound) {
+		return a.manager.create(a.ctx, a.subjectID)
+	}
+	return auth, err
+}
+
+func (a *subjectAuthenticator) Encrypt(secret []byte) ([]byte, error) {
+	auth, err := a.authOrCreate()
+	if err != nil {
+		return nil, err
+	}
+	return auth.Encrypt(secret)
+}
+
+func (a *subjectAuthenticator) Decrypt(ciphertext []byte) ([]byte, error) {
+	auth, err := a.auth()
+	if err != nil {
+		return nil, err
+	}
+	return auth.Decrypt(ciphertext)
+}
+
+func (a *subjectAuthenticator) EncryptWithAdditionalData(secret, additionalData []byte) ([]byte, error) {
+	auth, err := a.authOrCreate()
+	if err != nil {
+		return nil, err
+	}
+	return auth.EncryptWithAdditionalData(secret, additionalData)
+}
+
+func (a *subjectAuthenticator) DecryptWithAdditionalData(ciphertext, additionalData []byte) ([]byte, error) {
+	auth, err := a.auth()
+	if err != nil {
+		return nil, err
+	}
+	return auth.DecryptWithAdditionalData(ciphertext, additionalData)
+}
+
+func (a *subjectAuthenticator) HMAC(msg []byte) ([]byte, error) {
+	auth, err := a.authOrCreate()
+	if err != nil {
+		return nil, err
+	}
+	return auth.HMAC(msg)
+}
+
+func (a *subjectAuthenticator) HMACCheck(msg, expected []byte) error {
+	auth, err := a.auth()
+	if err != nil {
+		return err
+	}
+	return auth.HMACCheck(msg, expected)
+}
+
+func (a *subjectAuthenticator) NewHMACWriter() (*HMACWriter, error) {
+	auth, err := a.authOrCreate()
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewHMACWriter()
+}
+
+func (a *subjectAuthenticator) NewHMACVerifier(expected []byte) (*HMACWriter, error) {
+	auth, err := a.auth()
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewHMACVerifier(expected)
+}
+
+func subjectKeyAdditionalData(subjectID string) []byte {
+	return []byte("secret-subject-key:" + subjectID)
+}
+
+// MemorySubjectKeyStore is SubjectKeyStore backed by memory, e.g. for tests.
+type MemorySubjectKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string][]byte
+}
+
+func NewMemorySubjectKeyStore() *MemorySubjectKeyStore {
+	return &MemorySubjectKeyStore{keys: map[string][]byte{}}
+}
+
+func (s *MemorySubjectKeyStore) Get(_ context.Context, subjectID string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	wrapped, ok := s.keys[subjectID]
+	switch {
+	case !ok:
+		return nil, ErrSubjectKeyNotFound
+	case wrapped == nil:
+		return nil, ErrKeyShredded
+	}
+	return append([]byte(nil), wrapped...), nil
+}
+
+func (s *MemorySubjectKeyStore) Put(_ context.Context, subjectID string, wrapped []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.keys[subjectID]; ok {
+		if existing == nil {
+			return ErrKeyShredded
+		}
+		return ErrSubjectKeyConflict
+	}
+	s.keys[subjectID] = append([]byte{}, wrapped...)
+	return nil
+}
+
+// Shred replaces wrapped key of subject with a tombstone.
+func (s *MemorySubjectKeyStore) Shred(_ context.Context, subjectID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[subjectID] = nil
+	return nil
+}
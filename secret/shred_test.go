@@ -0,0 +1,371 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func getSubjectKeyManager(t *testing.T, store SubjectKeyStore) *SubjectKeyManager {
+	t.Helper()
+	m, err := NewSubjectKeyManager(getAuth(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestSubjectKeyManager(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemorySubjectKeyStore()
+	m := getSubjectKeyManager(t, store)
+
+	if _, err := m.Lookup(ctx, "kirby"); !errors.Is(err, ErrSubjectKeyNotFound) {
+		t.Fatalf("expecting ErrSubjectKeyNotFound, but received %v", err)
+	}
+	kirby, err := m.AuthenticatorFor(ctx, "kirby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := kirby.Encrypt([]byte("poyo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := store.Get(ctx, "kirby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wrapped) == 0 {
+		t.Fatal("wrapped key was not stored")
+	}
+
+	// Keys are looked up rather than recreated.
+	again, err := m.AuthenticatorFor(ctx, "kirby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := again.Decrypt(ciphertext); err != nil || string(plaintext) != "poyo" {
+		t.Fatalf("unexpected plaintext: %q (%v)", plaintext, err)
+	}
+
+	// Keys of other subjects are different.
+	dedede, err := m.AuthenticatorFor(ctx, "dedede")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dedede.Encrypt([]byte("poyo")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dedede.Decrypt(ciphertext); err == nil {
+		t.Fatal("ciphertext of kirby was unexpectedly decrypted with key of dedede")
+	}
+
+	// Wrapped keys are bound to their subjects.
+	swapped := NewMemorySubjectKeyStore()
+	if err := swapped.Put(ctx, "dedede", wrapped); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getSubjectKeyManager(t, swapped).Lookup(ctx, "dedede"); err == nil {
+		t.Fatal("wrapped key of kirby was unexpectedly unwrapped for dedede")
+	}
+
+	if err := m.Shred(ctx, "kirby"); err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		func() error { _, err := m.Lookup(ctx, "kirby"); return err }(),
+		func() error { _, err := m.AuthenticatorFor(ctx, "kirby"); return err }(),
+		func() error { _, err := m.Create(ctx, "kirby"); return err }(),
+	} {
+		if !errors.Is(err, ErrKeyShredded) {
+			t.Fatalf("expecting ErrKeyShredded, but received %v", err)
+		}
+	}
+	if _, err := m.Lookup(ctx, "dedede"); err != nil {
+		t.Fatalf("key of dedede was affected by shredding kirby: %v", err)
+	}
+}
+
+func TestSubjectKeyManagerResolver(t *testing.T) {
+	m := getSubjectKeyManager(t, NewMemorySubjectKeyStore())
+	SetGlobalResolver(m)
+	defer SetGlobalResolver(nil)
+
+	type profile struct {
+		Email String `json:"email"`
+	}
+	ctx := WithTenant(context.Background(), "kirby")
+	raw, err := EncodeJSON(ctx, &profile{Email: NewString("kirby@dreamland.example")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("dreamland")) {
+		t.Fatalf("plaintext leaked: %s", raw)
+	}
+	var decoded profile
+	if err := DecodeJSON(ctx, raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Email.Value() != "kirby@dreamland.example" {
+		t.Fatalf("unexpected email: %s", decoded.Email.Value())
+	}
+
+	if err := m.Shred(context.Background(), "kirby"); err != nil {
+		t.Fatal(err)
+	}
+	// Copies encoded before shredding can no longer be decrypted.
+	if err := DecodeJSON(ctx, raw, &decoded); !errors.Is(err, ErrKeyShredded) {
+		t.Fatalf("expecting ErrKeyShredded, but received %v", err)
+	}
+	if _, err := EncodeJSON(ctx, &decoded); !errors.Is(err, ErrKeyShredded) {
+		t.Fatalf("expecting ErrKeyShredded, but received %v", err)
+	}
+}
+
+func TestSubjectKeyManagerShredBoundValues(t *testing.T) {
+	m := getSubjectKeyManager(t, NewMemorySubjectKeyStore())
+	SetGlobalResolver(m)
+	defer SetGlobalResolver(nil)
+
+	type profile struct {
+		Email String `json:"email"`
+	}
+	ctx := WithTenant(context.Background(), "kirby")
+	raw, err := EncodeJSON(ctx, &profile{Email: NewString("kirby@dreamland.example")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// DecodeJSON binds authenticator of kirby to decoded.Email.
+	var decoded profile
+	if err := DecodeJSON(ctx, raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Shred(context.Background(), "kirby"); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(raw, &decoded); !errors.Is(err, ErrKeyShredded) {
+		t.Fatalf("expecting ErrKeyShredded, but received %v", err)
+	}
+	if _, err := json.Marshal(&decoded); !errors.Is(err, ErrKeyShredded) {
+		t.Fatalf("expecting ErrKeyShredded, but received %v", err)
+	}
+}
+
+func TestSubjectKeyManagerConcurrentCreate(t *testing.T) {
+	ctx := context.Background()
+	m := getSubjectKeyManager(t, NewMemorySubjectKeyStore())
+	ciphertexts := make([][]byte, 8)
+	var wg sync.WaitGroup
+	for i := range ciphertexts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			auth, err := m.AuthenticatorFor(ctx, "kirby")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ciphertexts[i], err = auth.Encrypt([]byte("poyo"))
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	auth, err := m.Lookup(ctx, "kirby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ciphertext := range ciphertexts {
+		if _, err := auth.Decrypt(ciphertext); err != nil {
+			t.Fatalf("subject key was created concurrently more than once: %v", err)
+		}
+	}
+}
+
+// countingSubjectKeyStore counts lookups, recording context of the last one.
+type countingSubjectKeyStore struct {
+	*MemorySubjectKeyStore
+	mu   sync.Mutex
+	gets int
+	ctx  context.Context
+}
+
+func (s *countingSubjectKeyStore) Get(ctx context.Context, subjectID string) ([]byte, error) {
+	s.mu.Lock()
+	s.gets++
+	s.ctx = ctx
+	s.mu.Unlock()
+	return s.MemorySubjectKeyStore.Get(ctx, subjectID)
+}
+
+func TestSubjectKeyManagerCreatesOnEncryption(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemorySubjectKeyStore()
+	m := getSubjectKeyManager(t, store)
+
+	kirby, err := m.AuthenticatorFor(ctx, "kirby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kirby.Decrypt([]byte("poyo")); !errors.Is(err, ErrSubjectKeyNotFound) {
+		t.Fatalf("expecting ErrSubjectKeyNotFound, but received %v", err)
+	}
+	if err := kirby.HMACCheck([]byte("poyo"), []byte("poyo")); !errors.Is(err, ErrSubjectKeyNotFound) {
+		t.Fatalf("expecting ErrSubjectKeyNotFound, but received %v", err)
+	}
+	if _, err := store.Get(ctx, "kirby"); !errors.Is(err, ErrSubjectKeyNotFound) {
+		t.Fatalf("key was created by decryption: %v", err)
+	}
+
+	// Decoding for an unknown tenant does not create its key either.
+	SetGlobalResolver(m)
+	defer SetGlobalResolver(nil)
+	type profile struct {
+		Email String `json:"email"`
+	}
+	raw, err := EncodeJSON(WithTenant(ctx, "kirby"), &profile{Email: NewString("kirby@dreamland.example")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded profile
+	if err := DecodeJSON(WithTenant(ctx, "dedede"), raw, &decoded); !errors.Is(err, ErrSubjectKeyNotFound) {
+		t.Fatalf("expecting ErrSubjectKeyNotFound, but received %v", err)
+	}
+	if _, err := store.Get(ctx, "dedede"); !errors.Is(err, ErrSubjectKeyNotFound) {
+		t.Fatalf("key was created by decoding: %v", err)
+	}
+	if _, err := store.Get(ctx, "kirby"); err != nil {
+		t.Fatalf("key was not created by encoding: %v", err)
+	}
+}
+
+func TestSubjectKeyManagerContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "poyo")
+	store := &countingSubjectKeyStore{MemorySubjectKeyStore: NewMemorySubjectKeyStore()}
+	m := getSubjectKeyManager(t, store)
+
+	kirby, err := m.AuthenticatorFor(ctx, "kirby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.ctx = nil
+	if _, err := kirby.Encrypt([]byte("poyo")); err != nil {
+		t.Fatal(err)
+	}
+	if store.ctx == nil || store.ctx.Value(ctxKey{}) != "poyo" {
+		t.Fatal("lookup did not receive context of AuthenticatorFor")
+	}
+}
+
+func TestSubjectKeyManagerCache(t *testing.T) {
+	ctx := context.Background()
+	current := time.Unix(1_000_000, 0)
+	SetClock(func() time.Time { return current })
+	defer SetClock(nil)
+
+	// Without cache, every use looks up the store, so that shredding by other
+	// managers takes effect immediately.
+	store := &countingSubjectKeyStore{MemorySubjectKeyStore: NewMemorySubjectKeyStore()}
+	uncached := getSubjectKeyManager(t, store)
+	kirby, err := uncached.AuthenticatorFor(ctx, "kirby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := kirby.Encrypt([]byte("poyo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.gets = 0
+	for i := 0; i < 3; i++ {
+		if _, err := kirby.Decrypt(ciphertext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if store.gets != 3 {
+		t.Fatalf("expecting 3 lookups, but received %d", store.gets)
+	}
+
+	if _, err := NewSubjectKeyManager(getAuth(), store, WithSubjectKeyCache(0, 1)); err == nil {
+		t.Fatal("cache without ttl was unexpectedly accepted")
+	}
+	if _, err := NewSubjectKeyManager(getAuth(), store, WithSubjectKeyCache(time.Minute, 0)); err == nil {
+		t.Fatal("cache without size was unexpectedly accepted")
+	}
+	m, err := NewSubjectKeyManager(getAuth(), store, WithSubjectKeyCache(time.Minute, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := m.AuthenticatorFor(ctx, "kirby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.gets = 0
+	for i := 0; i < 3; i++ {
+		if _, err := cached.Decrypt(ciphertext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if store.gets != 0 {
+		t.Fatalf("expecting cached key, but received %d lookups", store.gets)
+	}
+
+	// Cached keys expire after ttl.
+	current = current.Add(time.Minute)
+	if _, err := cached.Decrypt(ciphertext); err != nil {
+		t.Fatal(err)
+	}
+	if store.gets != 1 {
+		t.Fatalf("expecting expired key to be looked up, but received %d lookups", store.gets)
+	}
+
+	// At most size subjects are cached.
+	dedede, err := m.AuthenticatorFor(ctx, "dedede")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deciphertext, err := dedede.Encrypt([]byte("poyo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dedede.Decrypt(deciphertext); err != nil {
+		t.Fatal(err)
+	}
+	store.gets = 0
+	if _, err := cached.Decrypt(ciphertext); err != nil {
+		t.Fatal(err)
+	}
+	if store.gets != 1 {
+		t.Fatalf("expecting evicted key to be looked up, but received %d lookups", store.gets)
+	}
+
+	// Shredding evicts the key immediately, while other managers keep their cached key
+	// until ttl elapses.
+	other, err := NewSubjectKeyManager(getAuth(), store, WithSubjectKeyCache(time.Minute, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKirby, err := other.AuthenticatorFor(ctx, "kirby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Shred(ctx, "kirby"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.Decrypt(ciphertext); !errors.Is(err, ErrKeyShredded) {
+		t.Fatalf("expecting ErrKeyShredded, but received %v", err)
+	}
+	if _, err := otherKirby.Decrypt(ciphertext); err != nil {
+		t.Fatalf("expecting cached key within ttl, but received %v", err)
+	}
+	current = current.Add(time.Minute)
+	if _, err := otherKirby.Decrypt(ciphertext); !errors.Is(err, ErrKeyShredded) {
+		t.Fatalf("expecting ErrKeyShredded, but received %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package secret
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signed URLs are similar to presigned URLs of S3: the URL carries its expiry, the
+// HTTP method it is valid for, names of signed query parameters, and a MAC over those
+// along with its path. Query parameters which are not signed may be added freely.
+
+var (
+	ErrURLSignature = errors.New("invalid url signature")
+	ErrURLMethod    = errors.New("url is signed for another method")
+	ErrURLExpired   = fmt.Errorf("url %w", ErrExpired)
+)
+
+const (
+	URLExpiresParam      = "X-Expires"
+	URLMethodParam       = "X-Method"
+	URLSignedParamsParam = "X-Signed-Params"
+	URLSignatureParam    = "X-Signature"
+)
+
+// Reason codes of refused signed URLs, as responded by SignedURLMiddleware.
+const (
+	URLReasonTampered    = "tampered"
+	URLReasonWrongMethod = "wrong_method"
+	URLReasonExpired     = "expired"
+)
+
+// SignURL returns a copy of u signed with auth, which is valid for requests with
+// method until expiresAt. Query parameters named in params are signed, therefore
+// cannot be modified, added, or removed, while others are not.
+func SignURL(auth Authenticator, method string, u *url.URL, expiresAt time.Time, params ...string) (*url.URL, error) {
+	if method == "" {
+		return nil, fmt.Errorf("method is required")
+	}
+	query := u.Query()
+	for _, p := range []string{URLExpiresParam, URLMethodParam, URLSignedParamsParam, URLSignatureParam} {
+		query.Del(p)
+	}
+	names := append([]string(nil), params...)
+	sort.Strings(names)
+
+	query.Set(URLExpiresParam, strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set(URLMethodParam, strings.ToUpper(method))
+	if len(names) > 0 {
+		query.Set(URLSignedParamsParam, strings.Join(names, ","))
+	}
+	mac, err := auth.HMAC(signedURLMessage(u.EscapedPath(), query))
+	if err != nil {
+		return nil, err
+	}
+	query.Set(URLSignatureParam, string(encodeBase64(mac)))
+
+	signed := *u
+	signed.RawQuery = query.Encode()
+	return &signed, nil
+}
+
+// VerifyURL validates URL signed by SignURL for a request with method, returning
+// ErrURLSignature, ErrURLMethod, or ErrURLExpired if it should be refused.
+func VerifyURL(auth Authenticator, method string, u *url.URL) error {
+	query := u.Query()
+	for _, p := range []string{URLExpiresParam, URLMethodParam, URLSignatureParam} {
+		if len(query[p]) != 1 {
+			return fmt.Errorf("%w: expecting exactly one %s", ErrURLSignature, p)
+		}
+	}
+	if len(query[URLSignedParamsParam]) > 1 {
+		return fmt.Errorf("%w: expecting at most one %s", ErrURLSignature, URLSignedParamsParam)
+	}
+	mac, err := decodeBase64([]byte(query.Get(URLSignatureParam)))
+	if err != nil || len(mac) == 0 {
+		return fmt.Errorf("%w: missing or malformed signature", ErrURLSignature)
+	}
+	if err := auth.HMACCheck(signedURLMessage(u.EscapedPath(), query), mac); err != nil {
+		return ErrURLSignature
+	}
+
+	// Parameters below are authenticated, therefore can be trusted.
+	if signed := query.Get(URLMethodParam); !strings.EqualFold(signed, method) {
+		return fmt.Errorf("%w: signed for %s, requested with %s", ErrURLMethod, signed, method)
+	}
+	unix, err := strconv.ParseInt(query.Get(URLExpiresParam), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed expiry", ErrURLSignature)
+	}
+	if expiresAt := time.Unix(unix, 0); !now().Before(expiresAt) {
+		return fmt.Errorf("%w at %s", ErrURLExpired, expiresAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// SignedURLMiddleware returns handler which verifies requests to URLs signed by SignURL
+// before passing them to next. Refused requests are responded with 403 Forbidden, and
+// the reason code (URLReasonTampered, URLReasonWrongMethod, or URLReasonExpired) as body.
+func SignedURLMiddleware(auth Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := VerifyURL(auth, r.Method, r.URL); err != nil {
+			http.Error(w, URLReason(err), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// URLReason returns reason code of error returned by VerifyURL.
+func URLReason(err error) string {
+	switch {
+	case errors.Is(err, ErrURLExpired):
+		return URLReasonExpired
+	case errors.Is(err, ErrURLMethod):
+		return URLReasonWrongMethod
+	}
+	return URLReasonTampered
+}
+
+// signedURLMessage serializes path, signing parameters, and signed query parameters
+// of a signed URL.
+func signedURLMessage(path string, query url.Values) []byte {
+	var b bytes.Buffer
+	writeMACEntry(&b, "path", []byte(path))
+	for _, p := range []string{URLExpiresParam, URLMethodParam, URLSignedParamsParam} {
+		writeMACEntry(&b, p, []byte(query.Get(p)))
+	}
+	if names := query.Get(URLSignedParamsParam); names != "" {
+		for _, name := range strings.Split(names, ",") {
+			// Number of values is written first, so that values are unambiguous.
+			writeMACEntry(&b, name, []byte(strconv.Itoa(len(query[name]))))
+			for _, value := range query[name] {
+				writeMACEntry(&b, name, []byte(value))
+			}
+		}
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,96 @@
+package secret
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedURL(t *testing.T) {
+	SetClock(func() time.Time { return time.Unix(1_500_000_000, 0) })
+	defer SetClock(nil)
+
+	auth := getAuth()
+	u, err := url.Parse("https://dreamland.example/files/star%20rod.pdf?disposition=inline&tag=a&tag=b&utm_source=mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := SignURL(auth, http.MethodGet, u, now().Add(time.Hour), "disposition", "tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("signed url: %s", signed)
+	if err := VerifyURL(auth, http.MethodGet, signed); err != nil {
+		t.Fatal(err)
+	}
+
+	tamper := func(fn func(q url.Values)) *url.URL {
+		q := signed.Query()
+		fn(q)
+		tampered := *signed
+		tampered.RawQuery = q.Encode()
+		return &tampered
+	}
+	for name, tc := range map[string]struct {
+		url    *url.URL
+		method string
+		err    error
+	}{
+		"unsigned param": {tamper(func(q url.Values) { q.Set("utm_source", "web") }), http.MethodGet, nil},
+		"signed param":   {tamper(func(q url.Values) { q.Set("disposition", "attachment") }), http.MethodGet, ErrURLSignature},
+		"added value":    {tamper(func(q url.Values) { q.Add("tag", "c") }), http.MethodGet, ErrURLSignature},
+		"removed param":  {tamper(func(q url.Values) { q.Del("disposition") }), http.MethodGet, ErrURLSignature},
+		"signed params":  {tamper(func(q url.Values) { q.Set(URLSignedParamsParam, "tag") }), http.MethodGet, ErrURLSignature},
+		"expiry":         {tamper(func(q url.Values) { q.Set(URLExpiresParam, "1600000000") }), http.MethodGet, ErrURLSignature},
+		"duplicate":      {tamper(func(q url.Values) { q.Add(URLExpiresParam, "1600000000") }), http.MethodGet, ErrURLSignature},
+		"signature":      {tamper(func(q url.Values) { q.Del(URLSignatureParam) }), http.MethodGet, ErrURLSignature},
+		"path":           {&url.URL{Path: "/files/other.pdf", RawQuery: signed.RawQuery}, http.MethodGet, ErrURLSignature},
+		"method":         {signed, http.MethodDelete, ErrURLMethod},
+	} {
+		if err := VerifyURL(auth, tc.method, tc.url); !errors.Is(err, tc.err) {
+			t.Fatalf("%s: expecting %v, but received %v", name, tc.err, err)
+		}
+	}
+
+	SetClock(func() time.Time { return time.Unix(1_500_000_000, 0).Add(time.Hour) })
+	if err := VerifyURL(auth, http.MethodGet, signed); !errors.Is(err, ErrURLExpired) || !errors.Is(err, ErrExpired) {
+		t.Fatalf("expecting ErrURLExpired, but received %v", err)
+	}
+}
+
+func TestSignedURLMiddleware(t *testing.T) {
+	SetClock(func() time.Time { return time.Unix(1_500_000_000, 0) })
+	defer SetClock(nil)
+
+	auth := getAuth()
+	handler := SignedURLMiddleware(auth, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("star rod"))
+	}))
+	signed, err := SignURL(auth, http.MethodGet, &url.URL{Path: "/files/star-rod.pdf"}, now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method, target string) (int, string) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+	if code, body := request(http.MethodGet, signed.String()); code != http.StatusOK || body != "star rod" {
+		t.Fatalf("unexpected response: %d %s", code, body)
+	}
+	if code, body := request(http.MethodGet, "/files/star-rod.pdf"); code != http.StatusForbidden || body != URLReasonTampered {
+		t.Fatalf("unexpected response: %d %s", code, body)
+	}
+	if code, body := request(http.MethodPut, signed.String()); code != http.StatusForbidden || body != URLReasonWrongMethod {
+		t.Fatalf("unexpected response: %d %s", code, body)
+	}
+	SetClock(func() time.Time { return time.Unix(1_500_000_000, 0).Add(time.Hour) })
+	if code, body := request(http.MethodGet, signed.String()); code != http.StatusForbidden || body != URLReasonExpired {
+		t.Fatalf("unexpected response: %d %s", code, body)
+	}
+}
@@ -0,0 +1,355 @@
+package secret
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AES-SIV (RFC 5297) is deterministic: the same secret encrypted with the same key (and
+// additional data) always results in the same ciphertext, which allows equality joins
+// and uniqueness constraints over encrypted columns. In exchange, ciphertexts reveal
+// which secrets are equal, as well as their length. Unlike AES-GCM, it remains secure
+// otherwise, even if the same secret is encrypted many times.
+//
+// AES-SIV should only be used where equality is required, and secrets should have
+// enough entropy (e.g. not booleans or small enums) not to be guessed from frequency.
+
+var (
+	ErrSIVAuthentication = errors.New("aes-siv: message authentication failed")
+)
+
+const (
+	// AESSIVKeyLength is the key length of AES-256-SIV, which consists of 256-bit keys
+	// for S2V (CMAC) and CTR. Keys of 32 or 48 bytes (AES-128-SIV or AES-192-SIV) are
+	// also accepted.
+	AESSIVKeyLength = 64
+)
+
+var globalDeterministicAuth Authenticator
+
+var _ AdditionalDataAuthenticator = (*AESSIV)(nil)
+
+// AESSIV is a deterministic Authenticator implementing AES-SIV (RFC 5297).
+type AESSIV struct {
+	mac     cipher.Block
+	ctr     cipher.Block
+	hmacKey []byte
+}
+
+// NewAuthenticatorAESSIV creates AES-SIV authenticator from key, which is either 32,
+// 48, or 64 bytes.
+func NewAuthenticatorAESSIV(key []byte) (*AESSIV, error) {
+	switch len(key) {
+	case 32, 48, 64:
+	default:
+		return nil, fmt.Errorf("aes-siv key must be 32, 48, or 64 bytes, received %d", len(key))
+	}
+	mac, err := aes.NewCipher(key[:len(key)/2])
+	if err != nil {
+		return nil, err
+	}
+	ctr, err := aes.NewCipher(key[len(key)/2:])
+	if err != nil {
+		return nil, err
+	}
+	return &AESSIV{
+		mac: mac,
+		ctr: ctr,
+		// HMAC uses a derived key, as opposed to either half of the key used by SIV.
+		hmacKey: hkdf(sha256.New, key, nil, []byte("secret-aes-siv-hmac"), sha256.Size),
+	}, nil
+}
+
+// Encrypt takes in secret and outputs synthetic IV followed by ciphertext, which is
+// the same for the same secret.
+func (s *AESSIV) Encrypt(secret []byte) ([]byte, error) {
+	return s.seal(secret), nil
+}
+
+// EncryptWithAdditionalData is similar to Encrypt, except the ciphertext is bound to
+// additionalData, which must be provided to DecryptWithAdditionalData.
+func (s *AESSIV) EncryptWithAdditionalData(secret, additionalData []byte) ([]byte, error) {
+	return s.seal(secret, additionalData), nil
+}
+
+// Decrypt takes in ciphertext and outputs secret.
+func (s *AESSIV) Decrypt(ciphertext []byte) ([]byte, error) {
+	return s.open(ciphertext)
+}
+
+// DecryptWithAdditionalData decrypts ciphertext encrypted by EncryptWithAdditionalData
+// with the same additionalData.
+func (s *AESSIV) DecryptWithAdditionalData(ciphertext, additionalData []byte) ([]byte, error) {
+	return s.open(ciphertext, additionalData)
+}
+
+// HMAC creates a message authentication code (MAC) for a given message with nonce prefix.
+// Unlike ciphertexts, MACs are randomized.
+func (s *AESSIV) HMAC(msg []byte) ([]byte, error) {
+	nonce := make([]byte, hmacNonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return calcNonceHMAC(s.hmacKey, nonce, msg), nil
+}
+
+// HMACCheck validates if a message and its MAC is consistent.
+func (s *AESSIV) HMACCheck(msg, expected []byte) error {
+	if len(expected) < hmacNonceLength || !hmac.Equal(calcNonceHMAC(s.hmacKey, expected[:hmacNonceLength], msg), expected) {
+		return ErrHMACMismatch
+	}
+	return nil
+}
+
+// SetGlobalDeterministic configures the authenticator (e.g. AESSIV) used by
+// DeterministicBytes and DeterministicString without an attached authenticator.
+func SetGlobalDeterministic(a Authenticator) {
+	globalDeterministicAuth = a
+}
+
+// DeterministicBytes is similar to Bytes, except it is encrypted by the authenticator
+// configured by SetGlobalDeterministic unless one is attached, regardless of context.
+// Fields opt in to deterministic encryption by using it instead of Bytes, which should
+// only be done where equality of ciphertexts is required (e.g. unique columns).
+type DeterministicBytes struct {
+	Bytes
+}
+
+func NewDeterministicBytes(secret []byte) DeterministicBytes {
+	return DeterministicBytes{Bytes: NewBytes(secret)}
+}
+
+func NewDeterministicBytesWithAuth(authenticator Authenticator, secret []byte) DeterministicBytes {
+	return DeterministicBytes{Bytes: NewBytesWithAuth(authenticator, secret)}
+}
+
+func (s DeterministicBytes) MarshalText() ([]byte, error) {
+	return s.MarshalTextContext(context.Background())
+}
+
+// MarshalTextContext is similar to MarshalText. ctx does not affect the authenticator,
+// as tenants (or other authenticators attached to ctx) would not be deterministic.
+func (s DeterministicBytes) MarshalTextContext(ctx context.Context) ([]byte, error) {
+	b, err := s.bound()
+	if err != nil {
+		return nil, err
+	}
+	return b.MarshalTextContext(ctx)
+}
+
+func (s *DeterministicBytes) UnmarshalText(text []byte) error {
+	return s.UnmarshalTextContext(context.Background(), text)
+}
+
+// UnmarshalTextContext is similar to UnmarshalText, see MarshalTextContext.
+func (s *DeterministicBytes) UnmarshalTextContext(ctx context.Context, text []byte) error {
+	b, err := s.bound()
+	if err != nil {
+		return err
+	}
+	if err := b.UnmarshalTextContext(ctx, text); err != nil {
+		return err
+	}
+	s.secret = b.secret
+	return nil
+}
+
+func (s DeterministicBytes) MarshalBinary() ([]byte, error) {
+	return s.MarshalBinaryContext(context.Background())
+}
+
+// MarshalBinaryContext is similar to MarshalBinary, see MarshalTextContext.
+func (s DeterministicBytes) MarshalBinaryContext(ctx context.Context) ([]byte, error) {
+	b, err := s.bound()
+	if err != nil {
+		return nil, err
+	}
+	return b.MarshalBinaryContext(ctx)
+}
+
+func (s *DeterministicBytes) UnmarshalBinary(data []byte) error {
+	return s.UnmarshalBinaryContext(context.Background(), data)
+}
+
+// UnmarshalBinaryContext is similar to UnmarshalBinary, see MarshalTextContext.
+func (s *DeterministicBytes) UnmarshalBinaryContext(ctx context.Context, data []byte) error {
+	b, err := s.bound()
+	if err != nil {
+		return err
+	}
+	if err := b.UnmarshalBinaryContext(ctx, data); err != nil {
+		return err
+	}
+	s.secret = b.secret
+	return nil
+}
+
+// WithExpiry is similar to Bytes.WithExpiry, retaining deterministic encryption.
+// Authenticator must implement ExpiringAuthenticator, which AESSIV does not.
+func (s DeterministicBytes) WithExpiry(expiresAt time.Time) DeterministicBytes {
+	return DeterministicBytes{Bytes: s.Bytes.WithExpiry(expiresAt)}
+}
+
+// WithTTL is similar to Bytes.WithTTL, retaining deterministic encryption. As expiry is
+// relative to the time of marshaling, ciphertexts of the same secret no longer match.
+func (s DeterministicBytes) WithTTL(ttl time.Duration) DeterministicBytes {
+	return DeterministicBytes{Bytes: s.Bytes.WithTTL(ttl)}
+}
+
+// WithEncoding is similar to Bytes.WithEncoding, retaining deterministic encryption.
+func (s DeterministicBytes) WithEncoding(e Encoding) DeterministicBytes {
+	return DeterministicBytes{Bytes: s.Bytes.WithEncoding(e)}
+}
+
+// bound returns copy of s.Bytes with the deterministic authenticator attached.
+func (s DeterministicBytes) bound() (Bytes, error) {
+	b := s.Bytes
+	if b.authenticator == nil {
+		if globalDeterministicAuth == nil {
+			return b, fmt.Errorf("missing deterministic authenticator: use SetGlobalDeterministic")
+		}
+		b.authenticator = globalDeterministicAuth
+	}
+	return b, nil
+}
+
+type DeterministicString struct {
+	DeterministicBytes
+}
+
+func NewDeterministicString(secret string) DeterministicString {
+	return DeterministicString{DeterministicBytes: NewDeterministicBytes([]byte(secret))}
+}
+
+func NewDeterministicStringWithAuth(authenticator Authenticator, secret string) DeterministicString {
+	return DeterministicString{DeterministicBytes: NewDeterministicBytesWithAuth(authenticator, []byte(secret))}
+}
+
+func (s DeterministicString) Value() string {
+	return string(s.secret)
+}
+
+// WithExpiry is similar to String.WithExpiry, retaining deterministic encryption.
+func (s DeterministicString) WithExpiry(expiresAt time.Time) DeterministicString {
+	return DeterministicString{DeterministicBytes: s.DeterministicBytes.WithExpiry(expiresAt)}
+}
+
+// WithTTL is similar to String.WithTTL, see DeterministicBytes.WithTTL.
+func (s DeterministicString) WithTTL(ttl time.Duration) DeterministicString {
+	return DeterministicString{DeterministicBytes: s.DeterministicBytes.WithTTL(ttl)}
+}
+
+// WithEncoding is similar to String.WithEncoding, retaining deterministic encryption.
+func (s DeterministicString) WithEncoding(e Encoding) DeterministicString {
+	return DeterministicString{DeterministicBytes: s.DeterministicBytes.WithEncoding(e)}
+}
+
+// seal encrypts plaintext with associated data, as specified by RFC 5297 Section 2.6.
+func (s *AESSIV) seal(plaintext []byte, associatedData ...[]byte) []byte {
+	v := s.s2v(plaintext, associatedData)
+	out := make([]byte, aes.BlockSize+len(plaintext))
+	copy(out, v)
+	s.xorCTR(out[aes.BlockSize:], plaintext, v)
+	return out
+}
+
+// open decrypts ciphertext with associated data, as specified by RFC 5297 Section 2.7.
+func (s *AESSIV) open(ciphertext []byte, associatedData ...[]byte) ([]byte, error) {
+	if len(ciphertext) < aes.BlockSize {
+		return nil, ErrSIVAuthentication
+	}
+	v := ciphertext[:aes.BlockSize]
+	plaintext := make([]byte, len(ciphertext)-aes.BlockSize)
+	s.xorCTR(plaintext, ciphertext[aes.BlockSize:], v)
+	if subtle.ConstantTimeCompare(s.s2v(plaintext, associatedData), v) != 1 {
+		return nil, ErrSIVAuthentication
+	}
+	return plaintext, nil
+}
+
+// xorCTR encrypts (or decrypts) src into dst with AES-CTR, whose counter is v with 31st
+// and 63rd bits cleared.
+func (s *AESSIV) xorCTR(dst, src, v []byte) {
+	var q [aes.BlockSize]byte
+	copy(q[:], v)
+	q[8] &= 0x7f
+	q[12] &= 0x7f
+	cipher.NewCTR(s.ctr, q[:]).XORKeyStream(dst, src)
+}
+
+// s2v implements S2V of RFC 5297 Section 2.4, over associated data followed by plaintext.
+func (s *AESSIV) s2v(plaintext []byte, associatedData [][]byte) []byte {
+	var zero [aes.BlockSize]byte
+	d := s.cmac(zero[:])
+	for _, ad := range associatedData {
+		sivDouble(&d)
+		mac := s.cmac(ad)
+		xorBytes(d[:], d[:], mac[:])
+	}
+	var t []byte
+	if len(plaintext) >= aes.BlockSize {
+		t = append([]byte(nil), plaintext...)
+		end := t[len(t)-aes.BlockSize:]
+		xorBytes(end, end, d[:])
+	} else {
+		sivDouble(&d)
+		t = make([]byte, aes.BlockSize)
+		copy(t, plaintext)
+		t[len(plaintext)] = 0x80
+		xorBytes(t, t, d[:])
+	}
+	v := s.cmac(t)
+	return v[:]
+}
+
+// cmac implements AES-CMAC (RFC 4493) with the S2V key.
+func (s *AESSIV) cmac(msg []byte) [aes.BlockSize]byte {
+	var k1 [aes.BlockSize]byte
+	s.mac.Encrypt(k1[:], k1[:])
+	sivDouble(&k1)
+
+	var x [aes.BlockSize]byte
+	for len(msg) > aes.BlockSize {
+		xorBytes(x[:], x[:], msg[:aes.BlockSize])
+		s.mac.Encrypt(x[:], x[:])
+		msg = msg[aes.BlockSize:]
+	}
+	var last [aes.BlockSize]byte
+	copy(last[:], msg)
+	if len(msg) == aes.BlockSize {
+		xorBytes(last[:], last[:], k1[:])
+	} else {
+		// Incomplete (or empty) last block is padded and masked with K2.
+		last[len(msg)] = 0x80
+		k2 := k1
+		sivDouble(&k2)
+		xorBytes(last[:], last[:], k2[:])
+	}
+	xorBytes(x[:], x[:], last[:])
+	s.mac.Encrypt(x[:], x[:])
+	return x
+}
+
+// sivDouble multiplies b by x in GF(2^128), as "dbl" of RFC 5297.
+func sivDouble(b *[aes.BlockSize]byte) {
+	carry := b[0] >> 7
+	for i := 0; i < aes.BlockSize-1; i++ {
+		b[i] = b[i]<<1 | b[i+1]>>7
+	}
+	b[aes.BlockSize-1] = b[aes.BlockSize-1]<<1 ^ carry*0x87
+}
+
+// xorBytes sets dst[i] = x[i] ^ y[i] for every byte of x.
+func xorBytes(dst, x, y []byte) {
+	for i := range x {
+		dst[i] = x[i] ^ y[i]
+	}
+}
@@ -0,0 +1,199 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func getSIVAuth(t *testing.T) *AESSIV {
+	t.Helper()
+	key := mustDecodeHex(t, "fffefdfc fbfaf9f8 f7f6f5f4 f3f2f1f0 f0f1f2f3 f4f5f6f7 f8f9fafb fcfdfeff")
+	auth, err := NewAuthenticatorAESSIV(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+func TestAESSIVVectors(t *testing.T) {
+	// RFC 5297, Appendix A.1.
+	auth := getSIVAuth(t)
+	ad := mustDecodeHex(t, "10111213 14151617 18191a1b 1c1d1e1f 20212223 24252627")
+	plaintext := mustDecodeHex(t, "11223344 55667788 99aabbcc ddee")
+	expected := mustDecodeHex(t, "85632d07 c6e8f37f 950acd32 0a2ecc93 40c02b96 90c4dc04 daef7f6a fe5c")
+	ciphertext, err := auth.EncryptWithAdditionalData(plaintext, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ciphertext, expected) {
+		t.Fatalf("expecting %x, but received %x", expected, ciphertext)
+	}
+	decrypted, err := auth.DecryptWithAdditionalData(ciphertext, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("unexpected plaintext: %x", decrypted)
+	}
+
+	// RFC 5297, Appendix A.2, with multiple associated data and nonce.
+	key := mustDecodeHex(t, "7f7e7d7c 7b7a7978 77767574 73727170 40414243 44454647 48494a4b 4c4d4e4f")
+	if auth, err = NewAuthenticatorAESSIV(key); err != nil {
+		t.Fatal(err)
+	}
+	ad1 := mustDecodeHex(t, "00112233 44556677 8899aabb ccddeeff deaddada deaddada ffeeddcc bbaa9988 77665544 33221100")
+	ad2 := mustDecodeHex(t, "10203040 50607080 90a0")
+	nonce := mustDecodeHex(t, "09f91102 9d74e35b d84156c5 635688c0")
+	plaintext = mustDecodeHex(t, "74686973 20697320 736f6d65 20706c61 696e7465 78742074 6f20656e 63727970 74207573 696e6720 5349562d 414553")
+	expected = mustDecodeHex(t, "7bdb6e3b 432667eb 06f4d14b ff2fbd0f cb900f2f ddbe4043 26601965 c889bf17 dba77ceb 094fa663 b7a3f748 ba8af829 ea64ad54 4a272e9c 485b62a3 fd5c0d")
+	if ciphertext := auth.seal(plaintext, ad1, ad2, nonce); !bytes.Equal(ciphertext, expected) {
+		t.Fatalf("expecting %x, but received %x", expected, ciphertext)
+	}
+	if _, err := auth.open(expected, ad1, ad2, nonce); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAESSIV(t *testing.T) {
+	auth := getSIVAuth(t)
+	for _, secret := range []string{"", "poyo", strings.Repeat("poyo", 4), strings.Repeat("poyo", 17)} {
+		ciphertext, err := auth.Encrypt([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := auth.Encrypt([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(ciphertext, again) {
+			t.Fatalf("%q: ciphertexts are unexpectedly not deterministic", secret)
+		}
+		decrypted, err := auth.Decrypt(ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(decrypted) != secret {
+			t.Fatalf("expecting %q, but received %q", secret, decrypted)
+		}
+
+		// Tampered ciphertexts, or mismatching additional data, are refused.
+		for i := range ciphertext {
+			tampered := append([]byte(nil), ciphertext...)
+			tampered[i] ^= 1
+			if _, err := auth.Decrypt(tampered); !errors.Is(err, ErrSIVAuthentication) {
+				t.Fatalf("%q: expecting ErrSIVAuthentication, but received %v", secret, err)
+			}
+		}
+		if _, err := auth.DecryptWithAdditionalData(ciphertext, []byte("users.email")); !errors.Is(err, ErrSIVAuthentication) {
+			t.Fatalf("%q: expecting ErrSIVAuthentication, but received %v", secret, err)
+		}
+	}
+	if _, err := auth.Decrypt([]byte("short")); !errors.Is(err, ErrSIVAuthentication) {
+		t.Fatalf("expecting ErrSIVAuthentication, but received %v", err)
+	}
+
+	mac, err := auth.HMAC([]byte("poyo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.HMACCheck([]byte("poyo"), mac); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.HMACCheck([]byte("poyo!"), mac); !errors.Is(err, ErrHMACMismatch) {
+		t.Fatalf("expecting ErrHMACMismatch, but received %v", err)
+	}
+
+	for _, n := range []int{0, 16, 63} {
+		if _, err := NewAuthenticatorAESSIV(make([]byte, n)); err == nil {
+			t.Fatalf("%d-byte key was unexpectedly accepted", n)
+		}
+	}
+}
+
+func TestDeterministicString(t *testing.T) {
+	type user struct {
+		Email    DeterministicString `json:"email"`
+		Password String              `json:"password"`
+	}
+	SetGlobalDeterministic(getSIVAuth(t))
+	defer SetGlobalDeterministic(nil)
+
+	u := user{
+		Email:    NewDeterministicString("kirby@dreamland.example"),
+		Password: NewStringWithAuth(getAuth(), "poyo"),
+	}
+	first, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("ciphertext (json object): %s", first)
+	var a, b map[string]string
+	if err := json.Unmarshal(first, &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(second, &b); err != nil {
+		t.Fatal(err)
+	}
+	if a["email"] != b["email"] {
+		t.Fatalf("deterministic ciphertexts are unexpectedly unequal: %s, %s", a["email"], b["email"])
+	}
+	if a["password"] == b["password"] {
+		t.Fatal("randomized ciphertexts are unexpectedly equal")
+	}
+
+	// Deterministic fields are not bound to the authenticator of context.
+	dst := user{}
+	ctx := WithAuthenticator(context.Background(), getAuth())
+	if err := DecodeJSON(ctx, first, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Email.Value() != "kirby@dreamland.example" || dst.Password.Value() != "poyo" {
+		t.Fatalf("unexpected user: %q, %q", dst.Email.Value(), dst.Password.Value())
+	}
+	if dst.Email.authenticator != nil {
+		t.Fatal("deterministic field was unexpectedly bound")
+	}
+
+	// Options of Bytes retain deterministic encryption.
+	hexEmail := u.Email.WithEncoding(EncodingHex)
+	first, err = hexEmail.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err = hexEmail.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) || strings.Trim(string(first), "0123456789abcdef") != "" {
+		t.Fatalf("unexpected hex ciphertexts: %s, %s", first, second)
+	}
+	// AESSIV does not embed expiry, hence refuses rather than falling back to Bytes.
+	var expiring DeterministicString = u.Email.WithTTL(time.Hour)
+	if _, err := expiring.MarshalText(); err == nil {
+		t.Fatal("expiring deterministic secret was unexpectedly marshaled")
+	}
+
+	SetGlobalDeterministic(nil)
+	if _, err := json.Marshal(u); err == nil {
+		t.Fatal("missing deterministic authenticator was unexpectedly accepted")
+	}
+}
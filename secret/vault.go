@@ -0,0 +1,513 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tokenization replaces sensitive values (e.g. card numbers) with random tokens, while
+// the values are only kept, encrypted, in a vault. Unlike ciphertexts, tokens have no
+// relation to their values, therefore systems which only handle tokens cannot reveal
+// them, regardless of keys.
+
+var (
+	ErrVaultTokenNotFound = errors.New("vault token not found")
+	ErrVaultConflict      = errors.New("vault record already exists")
+	ErrInvalidVaultValue  = errors.New("invalid vault value")
+)
+
+const (
+	// VaultTokenPrefix is the prefix of tokens, unless formats are preserved (see WithVaultFormat).
+	VaultTokenPrefix = "tok_"
+
+	// Tokens which collide with existing ones (likely with short formats) are regenerated
+	// up to this number of attempts.
+	vaultMaxAttempts = 10
+)
+
+// VaultRecord is a token and its value, as kept by VaultStore.
+type VaultRecord struct {
+	Token string `json:"token"`
+	// Index is blind index of the value, which maps equal values to the same token.
+	Index []byte `json:"index"`
+	// Ciphertext is the value as text of Bytes (see Bytes.MarshalText), encrypted with
+	// Token and Index as additional data, so that ciphertexts cannot be swapped between
+	// records.
+	Ciphertext string    `json:"ciphertext"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// VaultStore persists records of Vault. Stores only receive encrypted values.
+type VaultStore interface {
+	// Get returns record of token, or ErrVaultTokenNotFound.
+	Get(ctx context.Context, token string) (*VaultRecord, error)
+	// GetByIndex returns record of blind index, or ErrVaultTokenNotFound.
+	GetByIndex(ctx context.Context, index []byte) (*VaultRecord, error)
+	// Put adds record, or returns ErrVaultConflict if its token or index already exists.
+	Put(ctx context.Context, record *VaultRecord) error
+	// Delete removes record of token, or returns ErrVaultTokenNotFound.
+	Delete(ctx context.Context, token string) error
+}
+
+// VaultAction is the operation recorded by VaultEvent.
+type VaultAction string
+
+const (
+	VaultTokenize   VaultAction = "tokenize"
+	VaultDetokenize VaultAction = "detokenize"
+	VaultDelete     VaultAction = "delete"
+)
+
+// VaultEvent records an access to Vault. Values are never recorded.
+type VaultEvent struct {
+	Action VaultAction
+	Token  string
+	// Created reports whether Tokenize created a new token.
+	Created bool
+	At      time.Time
+	Err     error
+}
+
+// VaultAuditor records accesses to Vault, e.g. to an audit log. The context of the
+// access is provided, which may carry identity of the caller.
+type VaultAuditor interface {
+	Audit(ctx context.Context, event VaultEvent)
+}
+
+// VaultAuditorFunc is an adapter to allow the use of ordinary functions as VaultAuditor.
+type VaultAuditorFunc func(ctx context.Context, event VaultEvent)
+
+func (f VaultAuditorFunc) Audit(ctx context.Context, event VaultEvent) {
+	f(ctx, event)
+}
+
+// VaultOption configures optional behavior of a vault.
+type VaultOption func(*Vault) error
+
+// WithVaultFormat preserves format of values in tokens: characters of alphabet are
+// replaced by random ones of alphabet, except the last keepLast of them, while other
+// characters (e.g. separators) are kept. For example, with FF1Digits and 4,
+// "4111-1111-1111-1234" could be tokenized to "8302-5527-0914-1234".
+//
+// Tokens have fewer possible values, therefore short values may fail to be tokenized
+// with ErrVaultConflict once most tokens are taken. Values without characters of alphabet
+// beyond the last keepLast are refused with ErrInvalidVaultValue, as their tokens would
+// reveal them.
+func WithVaultFormat(alphabet string, keepLast int) VaultOption {
+	return func(v *Vault) error {
+		runes := []rune(alphabet)
+		if len(runes) < 2 {
+			return fmt.Errorf("vault format alphabet must have at least 2 characters")
+		}
+		if keepLast < 0 {
+			return fmt.Errorf("vault format keepLast must not be negative: %d", keepLast)
+		}
+		v.alphabet = runes
+		v.keepLast = keepLast
+		return nil
+	}
+}
+
+// WithVaultNormalizers configures normalizers of blind index, so that equivalent
+// values (e.g. card numbers with and without separators) share the same token.
+func WithVaultNormalizers(normalizers ...func(string) string) VaultOption {
+	return func(v *Vault) error {
+		v.normalizers = append(v.normalizers, normalizers...)
+		return nil
+	}
+}
+
+// WithVaultAuditor configures auditor which records every access to the vault.
+func WithVaultAuditor(a VaultAuditor) VaultOption {
+	return func(v *Vault) error {
+		v.auditor = a
+		return nil
+	}
+}
+
+// Vault maps values to random tokens, keeping the values encrypted in VaultStore.
+type Vault struct {
+	store       VaultStore
+	auth        AdditionalDataAuthenticator
+	index       *BlindIndex
+	normalizers []func(string) string
+	alphabet    []rune
+	keepLast    int
+	auditor     VaultAuditor
+}
+
+// NewVault returns Vault whose values are encrypted by auth and kept in store. Equal
+// values map to the same token through blind index (see NewBlindIndex) keyed by
+// indexKey. Authenticator must implement AdditionalDataAuthenticator.
+func NewVault(store VaultStore, auth Authenticator, indexKey []byte, opts ...VaultOption) (*Vault, error) {
+	if store == nil || auth == nil {
+		return nil, fmt.Errorf("vault requires store and authenticator")
+	}
+	ada, ok := auth.(AdditionalDataAuthenticator)
+	if !ok {
+		return nil, fmt.Errorf("authenticator %T does not support additional data", auth)
+	}
+	v := &Vault{store: store, auth: ada}
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, err
+		}
+	}
+	index, err := NewBlindIndex(indexKey, "secret-vault", WithNormalizers(v.normalizers...))
+	if err != nil {
+		return nil, err
+	}
+	v.index = index
+	return v, nil
+}
+
+// Tokenize returns token of value, which is created unless value has been tokenized.
+func (v *Vault) Tokenize(ctx context.Context, value []byte) (string, error) {
+	event := VaultEvent{Action: VaultTokenize}
+	token, err := v.tokenize(ctx, value, &event)
+	event.Token = token
+	v.audit(ctx, event, err)
+	return token, err
+}
+
+func (v *Vault) tokenize(ctx context.Context, value []byte, event *VaultEvent) (string, error) {
+	index := v.index.Compute(string(value))
+	record, err := v.store.GetByIndex(ctx, index)
+	if err == nil {
+		return v.verified(record)
+	}
+	if !errors.Is(err, ErrVaultTokenNotFound) {
+		return "", err
+	}
+	if v.alphabet != nil && v.replaceable(value) == 0 {
+		return "", fmt.Errorf("%w: no characters of alphabet to be replaced", ErrInvalidVaultValue)
+	}
+
+	for attempt := 0; attempt < vaultMaxAttempts; attempt++ {
+		token, err := v.newToken(value)
+		if err != nil {
+			return "", err
+		}
+		// Tokens equal to their values would reveal them, hence treated as collisions.
+		if token == string(value) {
+			continue
+		}
+		ciphertext, err := NewBytesWithAuth(v.recordAuth(token, index), value).MarshalText()
+		if err != nil {
+			return "", err
+		}
+		err = v.store.Put(ctx, &VaultRecord{
+			Token:      token,
+			Index:      index,
+			Ciphertext: string(ciphertext),
+			CreatedAt:  now(),
+		})
+		if err == nil {
+			event.Created = true
+			return token, nil
+		}
+		if !errors.Is(err, ErrVaultConflict) {
+			return "", err
+		}
+		// Either token collided, or value was tokenized concurrently.
+		if record, err := v.store.GetByIndex(ctx, index); err == nil {
+			return v.verified(record)
+		}
+	}
+	return "", fmt.Errorf("%w: unable to generate unique token", ErrVaultConflict)
+}
+
+// Detokenize returns value of token, or ErrVaultTokenNotFound.
+func (v *Vault) Detokenize(ctx context.Context, token string) ([]byte, error) {
+	value, err := v.detokenize(ctx, token)
+	v.audit(ctx, VaultEvent{Action: VaultDetokenize, Token: token}, err)
+	return value, err
+}
+
+func (v *Vault) detokenize(ctx context.Context, token string) ([]byte, error) {
+	record, err := v.store.Get(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if record.Token != token {
+		return nil, fmt.Errorf("vault store returned record of another token")
+	}
+	return v.decrypt(record)
+}
+
+// verified returns token of record found by blind index, once its ciphertext is
+// verified to belong to the token and index.
+func (v *Vault) verified(record *VaultRecord) (string, error) {
+	if _, err := v.decrypt(record); err != nil {
+		return "", err
+	}
+	return record.Token, nil
+}
+
+func (v *Vault) decrypt(record *VaultRecord) ([]byte, error) {
+	value := NewBytesWithAuth(v.recordAuth(record.Token, record.Index), nil)
+	if err := value.UnmarshalText([]byte(record.Ciphertext)); err != nil {
+		return nil, fmt.Errorf("unable to decrypt vault token: %w", err)
+	}
+	return value.Value(), nil
+}
+
+// recordAuth returns authenticator of value of record, which binds it to token and
+// index of the record.
+func (v *Vault) recordAuth(token string, index []byte) Authenticator {
+	return &additionalDataAuthenticator{
+		AdditionalDataAuthenticator: v.auth,
+		additionalData:              vaultAdditionalData(token, index),
+	}
+}
+
+func vaultAdditionalData(token string, index []byte) []byte {
+	var b bytes.Buffer
+	writeMACEntry(&b, "token", []byte(token))
+	writeMACEntry(&b, "index", index)
+	return b.Bytes()
+}
+
+// additionalDataAuthenticator encrypts and decrypts with fixed additional data, so that
+// Bytes can be bound to it.
+type additionalDataAuthenticator struct {
+	AdditionalDataAuthenticator
+	additionalData []byte
+}
+
+func (a *additionalDataAuthenticator) Encrypt(secret []byte) ([]byte, error) {
+	return a.EncryptWithAdditionalData(secret, a.additionalData)
+}
+
+func (a *additionalDataAuthenticator) Decrypt(ciphertext []byte) ([]byte, error) {
+	return a.DecryptWithAdditionalData(ciphertext, a.additionalData)
+}
+
+// Delete removes token and its value, after which the value would be tokenized to a
+// new token.
+func (v *Vault) Delete(ctx context.Context, token string) error {
+	err := v.store.Delete(ctx, token)
+	v.audit(ctx, VaultEvent{Action: VaultDelete, Token: token}, err)
+	return err
+}
+
+func (v *Vault) audit(ctx context.Context, event VaultEvent, err error) {
+	if v.auditor == nil {
+		return
+	}
+	event.At = now()
+	event.Err = err
+	v.auditor.Audit(ctx, event)
+}
+
+// replaceable returns number of characters of value which are replaced in tokens of
+// preserved format.
+func (v *Vault) replaceable(value []byte) int {
+	n := 0
+	for _, r := range string(value) {
+		if v.inAlphabet(r) {
+			n++
+		}
+	}
+	if n <= v.keepLast {
+		return 0
+	}
+	return n - v.keepLast
+}
+
+func (v *Vault) inAlphabet(r rune) bool {
+	for _, a := range v.alphabet {
+		if a == r {
+			return true
+		}
+	}
+	return false
+}
+
+// newToken returns a random token, preserving format of value if configured.
+func (v *Vault) newToken(value []byte) (string, error) {
+	if v.alphabet == nil {
+		return NewAPIToken(VaultTokenPrefix)
+	}
+	runes := []rune(string(value))
+	kept := 0
+	for i := len(runes) - 1; i >= 0; i-- {
+		if !v.inAlphabet(runes[i]) {
+			continue
+		}
+		if kept < v.keepLast {
+			kept++
+			continue
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(v.alphabet))))
+		if err != nil {
+			return "", err
+		}
+		runes[i] = v.alphabet[n.Int64()]
+	}
+	return string(runes), nil
+}
+
+// MemoryVaultStore is VaultStore backed by memory, e.g. for tests.
+type MemoryVaultStore struct {
+	mu      sync.RWMutex
+	records map[string]*VaultRecord
+	indexes map[string]string
+}
+
+func NewMemoryVaultStore() *MemoryVaultStore {
+	return &MemoryVaultStore{
+		records: map[string]*VaultRecord{},
+		indexes: map[string]string{},
+	}
+}
+
+func (m *MemoryVaultStore) Get(_ context.Context, token string) (*VaultRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	record, ok := m.records[token]
+	if !ok {
+		return nil, ErrVaultTokenNotFound
+	}
+	cp := *record
+	return &cp, nil
+}
+
+func (m *MemoryVaultStore) GetByIndex(ctx context.Context, index []byte) (*VaultRecord, error) {
+	m.mu.RLock()
+	token, ok := m.indexes[string(index)]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, ErrVaultTokenNotFound
+	}
+	return m.Get(ctx, token)
+}
+
+func (m *MemoryVaultStore) Put(_ context.Context, record *VaultRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.put(record)
+}
+
+func (m *MemoryVaultStore) put(record *VaultRecord) error {
+	if record.Token == "" {
+		return fmt.Errorf("vault record requires token")
+	}
+	if _, ok := m.records[record.Token]; ok {
+		return ErrVaultConflict
+	}
+	if _, ok := m.indexes[string(record.Index)]; ok {
+		return ErrVaultConflict
+	}
+	cp := *record
+	m.records[cp.Token] = &cp
+	m.indexes[string(cp.Index)] = cp.Token
+	return nil
+}
+
+func (m *MemoryVaultStore) Delete(_ context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.delete(token)
+	return err
+}
+
+func (m *MemoryVaultStore) delete(token string) (*VaultRecord, error) {
+	record, ok := m.records[token]
+	if !ok {
+		return nil, ErrVaultTokenNotFound
+	}
+	delete(m.records, token)
+	delete(m.indexes, string(record.Index))
+	return record, nil
+}
+
+// FileVaultStore is VaultStore backed by a JSON file, which is rewritten atomically on
+// every change. Records are kept in memory, therefore it suits small vaults, and the
+// file should not be shared by multiple processes.
+type FileVaultStore struct {
+	path   string
+	memory *MemoryVaultStore
+}
+
+// NewFileVaultStore returns FileVaultStore of path, reading its records if it exists.
+func NewFileVaultStore(path string) (*FileVaultStore, error) {
+	f := &FileVaultStore{path: path, memory: NewMemoryVaultStore()}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []*VaultRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("unable to decode vault %s: %w", path, err)
+	}
+	for _, record := range records {
+		if err := f.memory.put(record); err != nil {
+			return nil, fmt.Errorf("unable to decode vault %s: %w", path, err)
+		}
+	}
+	return f, nil
+}
+
+func (f *FileVaultStore) Get(ctx context.Context, token string) (*VaultRecord, error) {
+	return f.memory.Get(ctx, token)
+}
+
+func (f *FileVaultStore) GetByIndex(ctx context.Context, index []byte) (*VaultRecord, error) {
+	return f.memory.GetByIndex(ctx, index)
+}
+
+func (f *FileVaultStore) Put(_ context.Context, record *VaultRecord) error {
+	f.memory.mu.Lock()
+	defer f.memory.mu.Unlock()
+	if err := f.memory.put(record); err != nil {
+		return err
+	}
+	if err := f.save(); err != nil {
+		f.memory.delete(record.Token)
+		return err
+	}
+	return nil
+}
+
+func (f *FileVaultStore) Delete(_ context.Context, token string) error {
+	f.memory.mu.Lock()
+	defer f.memory.mu.Unlock()
+	record, err := f.memory.delete(token)
+	if err != nil {
+		return err
+	}
+	if err := f.save(); err != nil {
+		f.memory.put(record)
+		return err
+	}
+	return nil
+}
+
+// save writes every record to the file, sorted by token. Lock of memory must be held.
+func (f *FileVaultStore) save() error {
+	records := make([]*VaultRecord, 0, len(f.memory.records))
+	for _, record := range f.memory.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Token < records[j].Token
+	})
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path, append(data, '\n'))
+}
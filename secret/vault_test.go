@@ -0,0 +1,292 @@
+package secret
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func getVault(t *testing.T, store VaultStore, opts ...VaultOption) *Vault {
+	t.Helper()
+	v, err := NewVault(store, getAuth(), getBlindIndexKey(t), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestVault(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	var events []VaultEvent
+	auditor := VaultAuditorFunc(func(_ context.Context, event VaultEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	})
+	v := getVault(t, NewMemoryVaultStore(), WithVaultAuditor(auditor))
+
+	token, err := v.Tokenize(ctx, []byte("4111111111111111"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseAPIToken(token); err != nil || !strings.HasPrefix(token, VaultTokenPrefix) {
+		t.Fatalf("unexpected token: %s (%v)", token, err)
+	}
+	again, err := v.Tokenize(ctx, []byte("4111111111111111"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != token {
+		t.Fatalf("same value was tokenized to different tokens: %s, %s", token, again)
+	}
+	other, err := v.Tokenize(ctx, []byte("5555555555554444"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == token {
+		t.Fatal("different values were tokenized to the same token")
+	}
+
+	value, err := v.Detokenize(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "4111111111111111" {
+		t.Fatalf("unexpected value: %s", value)
+	}
+
+	if err := v.Delete(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Detokenize(ctx, token); !errors.Is(err, ErrVaultTokenNotFound) {
+		t.Fatalf("expecting ErrVaultTokenNotFound, but received %v", err)
+	}
+	if err := v.Delete(ctx, token); !errors.Is(err, ErrVaultTokenNotFound) {
+		t.Fatalf("expecting ErrVaultTokenNotFound, but received %v", err)
+	}
+	if renewed, err := v.Tokenize(ctx, []byte("4111111111111111")); err != nil || renewed == token {
+		t.Fatalf("unexpected token after deletion: %s (%v)", renewed, err)
+	}
+
+	expected := []struct {
+		action  VaultAction
+		created bool
+		failed  bool
+	}{
+		{VaultTokenize, true, false},
+		{VaultTokenize, false, false},
+		{VaultTokenize, true, false},
+		{VaultDetokenize, false, false},
+		{VaultDelete, false, false},
+		{VaultDetokenize, false, true},
+		{VaultDelete, false, true},
+		{VaultTokenize, true, false},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("unexpected number of events: %d", len(events))
+	}
+	for i, e := range expected {
+		event := events[i]
+		if event.Action != e.action || event.Created != e.created || (event.Err != nil) != e.failed || event.Token == "" || event.At.IsZero() {
+			t.Fatalf("unexpected event #%d: %+v", i, event)
+		}
+	}
+}
+
+func TestVaultFormat(t *testing.T) {
+	ctx := context.Background()
+	v := getVault(t, NewMemoryVaultStore(), WithVaultFormat(FF1Digits, 4), WithVaultNormalizers(NormalizeDigits))
+
+	token, err := v.Tokenize(ctx, []byte("4111-1111-1111-1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("token: %s", token)
+	if len(token) != len("4111-1111-1111-1234") || token[4] != '-' || token[9] != '-' || token[14] != '-' || !strings.HasSuffix(token, "1234") {
+		t.Fatalf("unexpected token: %s", token)
+	}
+	if NormalizeDigits(token) != strings.ReplaceAll(token, "-", "") {
+		t.Fatalf("unexpected token: %s", token)
+	}
+	// Equivalent values share the same token.
+	if again, err := v.Tokenize(ctx, []byte("4111 1111 1111 1234")); err != nil || again != token {
+		t.Fatalf("unexpected token of equivalent value: %s (%v)", again, err)
+	}
+
+	// Tokens of short formats collide, yet remain unique.
+	short := getVault(t, NewMemoryVaultStore(), WithVaultFormat("ab", 0))
+	seen := map[string]bool{}
+	for _, value := range []string{"aaaa", "aaab", "aaba", "abaa", "baaa"} {
+		token, err := short.Tokenize(ctx, []byte(value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token == value || seen[token] {
+			t.Fatalf("%s: unexpected token: %s", value, token)
+		}
+		seen[token] = true
+	}
+
+	if _, err := NewVault(NewMemoryVaultStore(), getAuth(), getBlindIndexKey(t), WithVaultFormat("a", 0)); err == nil {
+		t.Fatal("invalid alphabet was unexpectedly accepted")
+	}
+
+	// Values whose tokens would equal them are refused.
+	for _, value := range []string{"----", "12-34"} {
+		if _, err := v.Tokenize(ctx, []byte(value)); !errors.Is(err, ErrInvalidVaultValue) {
+			t.Fatalf("%s: expecting ErrInvalidVaultValue, but received %v", value, err)
+		}
+	}
+}
+
+func TestVaultTampered(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryVaultStore()
+	v := getVault(t, store)
+	kirby, err := v.Tokenize(ctx, []byte("4111111111111111"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dedede, err := v.Tokenize(ctx, []byte("5555555555554444"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ciphertexts swapped between records are refused.
+	store.records[kirby].Ciphertext, store.records[dedede].Ciphertext = store.records[dedede].Ciphertext, store.records[kirby].Ciphertext
+	for _, token := range []string{kirby, dedede} {
+		if value, err := v.Detokenize(ctx, token); err == nil {
+			t.Fatalf("swapped ciphertext was unexpectedly decrypted: %s", value)
+		}
+	}
+	store.records[kirby].Ciphertext, store.records[dedede].Ciphertext = store.records[dedede].Ciphertext, store.records[kirby].Ciphertext
+
+	// Indexes swapped between records are refused.
+	store.records[kirby].Index, store.records[dedede].Index = store.records[dedede].Index, store.records[kirby].Index
+	store.indexes[string(store.records[kirby].Index)] = kirby
+	store.indexes[string(store.records[dedede].Index)] = dedede
+	if token, err := v.Tokenize(ctx, []byte("4111111111111111")); err == nil {
+		t.Fatalf("record of swapped index was unexpectedly returned: %s", token)
+	}
+
+	if _, err := NewVault(store, reverseAuth{}, getBlindIndexKey(t)); err == nil {
+		t.Fatal("authenticator without additional data was unexpectedly accepted")
+	}
+}
+
+func TestFileVaultStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "vault.json")
+	store, err := NewFileVaultStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := getVault(t, store)
+	token, err := v.Tokenize(ctx, []byte("4111111111111111"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := v.Tokenize(ctx, []byte("5555555555554444"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Delete(ctx, deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("vault file:\n%s", raw)
+	if strings.Contains(string(raw), "4111") || strings.Contains(string(raw), deleted) || !strings.Contains(string(raw), token) {
+		t.Fatalf("unexpected vault file:\n%s", raw)
+	}
+
+	reopened, err := NewFileVaultStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v = getVault(t, reopened)
+	value, err := v.Detokenize(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "4111111111111111" {
+		t.Fatalf("unexpected value: %s", value)
+	}
+	if again, err := v.Tokenize(ctx, []byte("4111111111111111")); err != nil || again != token {
+		t.Fatalf("unexpected token after reopening: %s (%v)", again, err)
+	}
+
+	if err := os.WriteFile(path, []byte("poyo"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileVaultStore(path); err == nil {
+		t.Fatal("malformed vault file was unexpectedly accepted")
+	}
+}
+
+func TestVaultConcurrentTokenize(t *testing.T) {
+	ctx := context.Background()
+	v := getVault(t, NewMemoryVaultStore())
+	tokens := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token, err := v.Tokenize(ctx, []byte("4111111111111111"))
+			if err != nil {
+				t.Error(err)
+			}
+			tokens[i] = token
+		}(i)
+	}
+	wg.Wait()
+	for _, token := range tokens {
+		if token != tokens[0] {
+			t.Fatalf("same value was tokenized concurrently to different tokens: %v", tokens)
+		}
+	}
+}
+
+func TestVaultRecordBytes(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryVaultStore()
+	v := getVault(t, store)
+	token, err := v.Tokenize(ctx, []byte("4111111111111111"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := store.records[token]
+
+	// Values are kept as text of Bytes bound to their records.
+	value := NewBytesWithAuth(v.recordAuth(record.Token, record.Index), nil)
+	if err := value.UnmarshalText([]byte(record.Ciphertext)); err != nil {
+		t.Fatal(err)
+	}
+	if string(value.Value()) != "4111111111111111" {
+		t.Fatalf("unexpected value: %s", value.Value())
+	}
+	unbound := NewBytesWithAuth(getAuth(), nil)
+	if err := unbound.UnmarshalText([]byte(record.Ciphertext)); err == nil {
+		t.Fatal("value was unexpectedly decrypted without its record")
+	}
+
+	// Values are encrypted with token and index as additional data, base64 (URL variant)
+	// encoded, as before they were kept as Bytes.
+	ciphertext, err := getAuth().EncryptWithAdditionalData([]byte("5555555555554444"), vaultAdditionalData(token, record.Index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Ciphertext = string(encodeBase64(ciphertext))
+	if value, err := v.Detokenize(ctx, token); err != nil || string(value) != "5555555555554444" {
+		t.Fatalf("unexpected value: %s (%v)", value, err)
+	}
+}
@@ -0,0 +1,298 @@
+package secret
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.husin.dev/x/heap"
+)
+
+// Webhooks are signed in the style of Stripe and GitHub: the signature header contains
+// timestamp of signing and MACs (one for each active secret) of the timestamp and body,
+// formatted as "t=1492774577,v1=...,v1=...".
+
+var (
+	ErrWebhookSignature = errors.New("invalid webhook signature")
+	ErrWebhookTimestamp = errors.New("webhook timestamp outside of tolerance")
+	ErrWebhookReplay    = errors.New("webhook replayed")
+)
+
+const (
+	// WebhookSignatureHeader is the default header which carries webhook signature.
+	WebhookSignatureHeader = "Webhook-Signature"
+	// DefaultWebhookTolerance is the default tolerance of webhook timestamps.
+	DefaultWebhookTolerance = 5 * time.Minute
+	// DefaultWebhookReplayCacheSize is the default number of signatures remembered
+	// by WebhookVerifier to reject replays.
+	DefaultWebhookReplayCacheSize = 10000
+	// DefaultWebhookMaxBodySize is the default limit of request body read by
+	// WebhookVerifier middleware.
+	DefaultWebhookMaxBodySize = 1 << 20
+
+	webhookSchemeV1 = "v1"
+)
+
+// WebhookSigner signs outgoing webhooks.
+type WebhookSigner struct {
+	// Header carries the signature, WebhookSignatureHeader unless set.
+	Header string
+	auths  []Authenticator
+}
+
+// NewWebhookSigner returns WebhookSigner which signs webhooks with every authenticator
+// in auths, so that receivers can verify them with any of those during rotation.
+func NewWebhookSigner(auths ...Authenticator) (*WebhookSigner, error) {
+	if len(auths) == 0 {
+		return nil, fmt.Errorf("at least one authenticator is required")
+	}
+	return &WebhookSigner{Header: WebhookSignatureHeader, auths: auths}, nil
+}
+
+// Sign returns signature header value of body signed at t.
+func (s *WebhookSigner) Sign(t time.Time, body []byte) (string, error) {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	msg := webhookMessage(ts, body)
+	fields := []string{"t=" + ts}
+	for _, auth := range s.auths {
+		mac, err := auth.HMAC(msg)
+		if err != nil {
+			return "", err
+		}
+		fields = append(fields, webhookSchemeV1+"="+string(encodeBase64(mac)))
+	}
+	return strings.Join(fields, ","), nil
+}
+
+// SignRequest signs body of req at current time, setting the signature header.
+// The body is read and replaced, so that it can still be sent.
+func (s *WebhookSigner) SignRequest(req *http.Request) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	signature, err := s.Sign(now(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(s.header(), signature)
+	return nil
+}
+
+func (s *WebhookSigner) header() string {
+	if s.Header == "" {
+		return WebhookSignatureHeader
+	}
+	return s.Header
+}
+
+// WebhookVerifier verifies incoming webhooks signed by WebhookSigner. Webhooks with
+// timestamps outside of tolerance are refused, and signatures which have been seen
+// are remembered until they are outside of tolerance, so that replays are refused.
+//
+// Fields should be configured before the first verification.
+type WebhookVerifier struct {
+	// Header carries the signature, WebhookSignatureHeader unless set.
+	Header string
+	// Tolerance is the maximum difference between timestamp of the signature and
+	// current time, DefaultWebhookTolerance unless set.
+	Tolerance time.Duration
+	// ReplayCacheSize is the maximum number of signatures remembered to reject replays,
+	// DefaultWebhookReplayCacheSize unless set. Once full, the oldest signatures are
+	// forgotten before they are outside of tolerance.
+	ReplayCacheSize int
+	// MaxBodySize limits request body read by Middleware, DefaultWebhookMaxBodySize unless set.
+	MaxBodySize int64
+
+	auths     []Authenticator
+	cacheOnce sync.Once
+	cache     *replayCache
+}
+
+// NewWebhookVerifier returns WebhookVerifier which accepts webhooks signed by any of
+// auths, so that secrets can be rotated without downtime.
+func NewWebhookVerifier(auths ...Authenticator) (*WebhookVerifier, error) {
+	if len(auths) == 0 {
+		return nil, fmt.Errorf("at least one authenticator is required")
+	}
+	return &WebhookVerifier{
+		Header:          WebhookSignatureHeader,
+		Tolerance:       DefaultWebhookTolerance,
+		ReplayCacheSize: DefaultWebhookReplayCacheSize,
+		MaxBodySize:     DefaultWebhookMaxBodySize,
+		auths:           auths,
+	}, nil
+}
+
+// Verify validates signature header value of body, returning ErrWebhookSignature,
+// ErrWebhookTimestamp, or ErrWebhookReplay if it should be refused.
+func (v *WebhookVerifier) Verify(signature string, body []byte) error {
+	var ts string
+	var macs [][]byte
+	for _, field := range strings.Split(signature, ",") {
+		k, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			ts = value
+		case webhookSchemeV1:
+			if mac, err := decodeBase64([]byte(value)); err == nil {
+				macs = append(macs, mac)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: missing or invalid timestamp", ErrWebhookSignature)
+	}
+	if len(macs) == 0 {
+		return fmt.Errorf("%w: missing %s signature", ErrWebhookSignature, webhookSchemeV1)
+	}
+
+	tolerance := v.tolerance()
+	signedAt := time.Unix(unix, 0)
+	if d := now().Sub(signedAt); d > tolerance || d < -tolerance {
+		return fmt.Errorf("%w: signed at %s", ErrWebhookTimestamp, signedAt.UTC().Format(time.RFC3339))
+	}
+
+	// Every valid signature is remembered, as otherwise the webhook could be replayed
+	// with only the signatures of other secrets.
+	msg := webhookMessage(ts, body)
+	var valid []string
+	for _, mac := range macs {
+		for _, auth := range v.auths {
+			if auth.HMACCheck(msg, mac) == nil {
+				valid = append(valid, string(mac))
+				break
+			}
+		}
+	}
+	if len(valid) == 0 {
+		return ErrWebhookSignature
+	}
+	// Signatures are remembered until their timestamp is outside of tolerance, after
+	// which they are refused regardless.
+	if !v.replayCache().add(valid, signedAt.Add(tolerance)) {
+		return ErrWebhookReplay
+	}
+	return nil
+}
+
+// Middleware returns handler which verifies incoming webhooks before passing them
+// to next, responding with 401 Unauthorized if verification fails, or 413 Request
+// Entity Too Large if the body exceeds MaxBodySize.
+func (v *WebhookVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		maxBodySize := v.MaxBodySize
+		if maxBodySize <= 0 {
+			maxBodySize = DefaultWebhookMaxBodySize
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if int64(len(body)) > maxBodySize {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		header := v.Header
+		if header == "" {
+			header = WebhookSignatureHeader
+		}
+		if err := v.Verify(r.Header.Get(header), body); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (v *WebhookVerifier) tolerance() time.Duration {
+	if v.Tolerance <= 0 {
+		return DefaultWebhookTolerance
+	}
+	return v.Tolerance
+}
+
+func (v *WebhookVerifier) replayCache() *replayCache {
+	v.cacheOnce.Do(func() {
+		size := v.ReplayCacheSize
+		if size <= 0 {
+			size = DefaultWebhookReplayCacheSize
+		}
+		v.cache = newReplayCache(size)
+	})
+	return v.cache
+}
+
+// webhookMessage returns the signed message of webhook, which is timestamp and body.
+func webhookMessage(ts string, body []byte) []byte {
+	msg := make([]byte, 0, len(ts)+1+len(body))
+	msg = append(msg, ts...)
+	msg = append(msg, '.')
+	return append(msg, body...)
+}
+
+// replayCache remembers keys until they expire, up to size keys, evicting the
+// earliest to expire once full.
+type replayCache struct {
+	mu     sync.Mutex
+	size   int
+	seen   map[string]struct{}
+	expiry heap.SimpleHeap[replayEntry]
+}
+
+type replayEntry struct {
+	key       string
+	expiresAt time.Time
+}
+
+func newReplayCache(size int) *replayCache {
+	return &replayCache{
+		size: size,
+		seen: map[string]struct{}{},
+		expiry: heap.NewSimpleHeap(nil, func(left, right replayEntry) bool {
+			return left.expiresAt.Before(right.expiresAt)
+		}),
+	}
+}
+
+// add remembers keys until expiresAt, returning false if any of keys has already
+// been seen, in which case none of keys is added.
+func (c *replayCache) add(keys []string, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := now()
+	for c.expiry.Size() > 0 && !c.expiry.Peek().expiresAt.After(t) {
+		delete(c.seen, c.expiry.Pop().key)
+	}
+	for _, key := range keys {
+		if _, ok := c.seen[key]; ok {
+			return false
+		}
+	}
+	for _, key := range keys {
+		for c.expiry.Size() >= c.size {
+			delete(c.seen, c.expiry.Pop().key)
+		}
+		c.seen[key] = struct{}{}
+		c.expiry.Push(replayEntry{key: key, expiresAt: expiresAt})
+	}
+	return true
+}
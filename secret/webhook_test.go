@@ -0,0 +1,184 @@
+package secret
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getWebhookAuth(t *testing.T, hexKey string) *AESGCM {
+	t.Helper()
+	key, err := KeyFromString(hexKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := NewAuthenticatorAESGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+func TestWebhookSignVerify(t *testing.T) {
+	signedAt := time.Unix(1_500_000_000, 0)
+	SetClock(func() time.Time { return signedAt })
+	defer SetClock(nil)
+
+	auth := getAuth()
+	signer, err := NewWebhookSigner(auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewWebhookVerifier(auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"type":"invoice.paid"}`)
+	signature, err := signer.Sign(signedAt, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(signature, "t=1500000000,v1=") {
+		t.Fatalf("unexpected signature: %s", signature)
+	}
+
+	if err := verifier.Verify(signature, []byte(`{"type":"invoice.void"}`)); !errors.Is(err, ErrWebhookSignature) {
+		t.Fatalf("expecting ErrWebhookSignature, but received %v", err)
+	}
+	if err := verifier.Verify(strings.Replace(signature, "t=1500000000", "t=1500000001", 1), body); !errors.Is(err, ErrWebhookSignature) {
+		t.Fatalf("expecting ErrWebhookSignature, but received %v", err)
+	}
+	if err := verifier.Verify(signature, body); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(signature, body); !errors.Is(err, ErrWebhookReplay) {
+		t.Fatalf("expecting ErrWebhookReplay, but received %v", err)
+	}
+
+	signature, err = signer.Sign(signedAt, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetClock(func() time.Time { return signedAt.Add(DefaultWebhookTolerance + time.Second) })
+	if err := verifier.Verify(signature, body); !errors.Is(err, ErrWebhookTimestamp) {
+		t.Fatalf("expecting ErrWebhookTimestamp, but received %v", err)
+	}
+
+	for _, invalid := range []string{"", "v1=abc", "t=1500000000", "t=poyo,v1=abc"} {
+		if err := verifier.Verify(invalid, body); !errors.Is(err, ErrWebhookSignature) {
+			t.Fatalf("%q: expecting ErrWebhookSignature, but received %v", invalid, err)
+		}
+	}
+}
+
+func TestWebhookRotation(t *testing.T) {
+	oldAuth := getWebhookAuth(t, "955880d5f4f43c66751848c06fedb78e420995b373418dcfb856ca559deb71c3")
+	newAuth := getWebhookAuth(t, "bc3a6ab9e5e7f9a8fe0f1d1e8c6f4c0b4f4fd7d3e3e1a1b2c3d4e5f60718293a")
+
+	// During rotation, sender signs with both secrets, while receivers may know either.
+	signer, err := NewWebhookSigner(newAuth, oldAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"type":"invoice.paid"}`)
+	signature, err := signer.Sign(now(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, auths := range map[string][]Authenticator{
+		"old": {oldAuth},
+		"new": {newAuth},
+		"all": {oldAuth, newAuth},
+	} {
+		verifier, err := NewWebhookVerifier(auths...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := verifier.Verify(signature, body); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// Replaying with only some of the signatures is refused as well.
+		fields := strings.Split(signature, ",")
+		for _, partial := range []string{fields[0] + "," + fields[1], fields[0] + "," + fields[2]} {
+			if err := verifier.Verify(partial, body); !errors.Is(err, ErrWebhookReplay) && !errors.Is(err, ErrWebhookSignature) {
+				t.Fatalf("%s: partial signature was unexpectedly accepted: %v", name, err)
+			}
+		}
+	}
+
+	if _, err := NewWebhookSigner(); err == nil {
+		t.Fatal("signer without authenticators was unexpectedly accepted")
+	}
+	if _, err := NewWebhookVerifier(); err == nil {
+		t.Fatal("verifier without authenticators was unexpectedly accepted")
+	}
+}
+
+func TestWebhookMiddleware(t *testing.T) {
+	auth := getAuth()
+	signer, err := NewWebhookSigner(auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewWebhookVerifier(auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier.MaxBodySize = 64
+
+	var received string
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received = string(b)
+	}))
+	send := func(body string, sign bool) int {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body))
+		if sign {
+			if err := signer.SignRequest(req); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := send(`{"type":"invoice.paid"}`, true); code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", code)
+	}
+	if received != `{"type":"invoice.paid"}` {
+		t.Fatalf("unexpected body received by handler: %q", received)
+	}
+	if code := send(`{"type":"invoice.paid"}`, false); code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status: %d", code)
+	}
+	if code := send(strings.Repeat("a", 65), true); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected status: %d", code)
+	}
+}
+
+func TestReplayCacheBounded(t *testing.T) {
+	c := newReplayCache(2)
+	expiresAt := now().Add(time.Hour)
+	for _, key := range []string{"a", "b", "c"} {
+		if !c.add([]string{key}, expiresAt) {
+			t.Fatalf("%s was unexpectedly seen", key)
+		}
+	}
+	if c.expiry.Size() != 2 || len(c.seen) != 2 {
+		t.Fatalf("cache exceeded its size: %d", len(c.seen))
+	}
+	if c.add([]string{"c"}, expiresAt) {
+		t.Fatal("c was unexpectedly not seen")
+	}
+
+	// Expired keys are forgotten.
+	if !c.add([]string{"d"}, now().Add(-time.Second)) || !c.add([]string{"d"}, expiresAt) {
+		t.Fatal("expired key was unexpectedly remembered")
+	}
+}